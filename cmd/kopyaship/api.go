@@ -220,6 +220,8 @@ func (s *svc) setupRouter(e *echo.Echo) {
 	e.GET("/watch-job", s.getWatchJobs)
 	e.GET("/watch-job/stop", s.stopWatchJobs)
 	e.GET("/service/reload", s.reload)
+	e.GET("/check", s.getCheckStatuses)
+	e.GET("/schedule", s.getSchedule)
 }
 
 func (s *svc) newAPIServer() (
@@ -5,7 +5,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"github.com/tomruk/kopyaship/internal/backup"
 	_ctx "github.com/tomruk/kopyaship/internal/scripting/ctx"
@@ -17,6 +19,10 @@ func init() {
 	f := backupCmd.Flags()
 	f.Bool("no-remind", false, "Disable reminders")
 	f.Bool("no-hook", false, "Disable hook scripts")
+	f.Bool("dry-run", false, "Show what would be backed up, without touching the repositories")
+	f.String("save", "", "With --dry-run, save the include list of each backup to <name>.list in this directory")
+	f.Bool("program", false, "With --dry-run, also run the backup program in its dry run mode to show what would be added. Only supported by restic")
+	f.Bool("hooks", false, "With --dry-run, run the hooks too")
 }
 
 var backupCmd = &cobra.Command{
@@ -26,8 +32,16 @@ var backupCmd = &cobra.Command{
 			f           = cmd.Flags()
 			noRemind, _ = f.GetBool("no-remind")
 			noHook, _   = f.GetBool("no-hook")
+			dryRun, _   = f.GetBool("dry-run")
+			save, _     = f.GetString("save")
+			program, _  = f.GetBool("program")
+			hooks, _    = f.GetBool("hooks")
 			include     = args
 		)
+		if dryRun {
+			noRemind = true
+			noHook = noHook || !hooks
+		}
 
 		remindAll := func(reminders []string) {
 			if !noRemind {
@@ -45,6 +59,9 @@ var backupCmd = &cobra.Command{
 		}
 
 		runHooks := func(hooks []string, c _ctx.Context) error {
+			if bc, ok := c.Backup(); ok {
+				bc.DryRun = dryRun
+			}
 			if !noHook {
 				errGroup := errgroup.Group{}
 				for i, hook := range hooks {
@@ -63,7 +80,7 @@ var backupCmd = &cobra.Command{
 
 		ctx, cancel := context.WithCancel(context.Background())
 		addExitHandler(cancel)
-		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, debugLog, false, include...)
+		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, debugLog, false, include...)
 		if err != nil {
 			errPrintln(err)
 			exit(exitErrAny)
@@ -98,34 +115,87 @@ var backupCmd = &cobra.Command{
 				continue
 			}
 
-			err = backup.Do()
-			if err != nil {
-				errPrintln(err)
-				exit(exitErrAny)
-			}
-
-			if !noHook {
-				err = runHooks(
-					backup.Config.Hooks.Post,
-					_ctx.NewBackupContext(
-						false,
-						backup.Name,
-						backup.Provider.TargetPath(),
-						backup.Config.Base,
-						backup.Config.Paths,
-						func() {}, // Noop for post hooks
-						backup.UseIfile,
-					))
+			if dryRun {
+				savePath := ""
+				if save != "" {
+					savePath = filepath.Join(save, backup.Name+".list")
+				}
+				report, err := backup.DryRun(savePath, program)
+				if err != nil {
+					errPrintln(err)
+					exit(exitErrAny)
+				}
+				printDryRunReport(backup.Name, report)
+				if savePath != "" {
+					fmt.Printf("Include list is saved to: %s\n", savePath)
+				}
+				err = runAfterBackupHooks(backup, report.Provider, nil, runHooks)
 				if err != nil {
-					errPrintln(fmt.Errorf("failed to run post hook: %v: exiting", err))
+					errPrintln(fmt.Errorf("%v: exiting", err))
 					exit(exitErrAny)
 				}
+				continue
+			}
+
+			result, backupErr := backup.Do()
+			if backupErr != nil {
+				errPrintln(backupErr)
+			}
+			err = notifyBackup(ctx, backup.Name, result, backupErr)
+			if err != nil {
+				errPrintln(fmt.Errorf("failed to send notification: %v", err))
+			}
+
+			err = runAfterBackupHooks(backup, result, backupErr, runHooks)
+			if err != nil {
+				errPrintln(fmt.Errorf("%v: exiting", err))
+				exit(exitErrAny)
+			}
+			if backupErr != nil {
+				exit(exitErrAny)
 			}
+
 			if !noRemind {
 				remindAll(backup.Config.Reminders.Post)
 			}
 		}
 
+		if dryRun {
+			utils.Success.Println("\nDry run successful. Nothing is written to the repositories")
+			return
+		}
 		utils.Success.Println("\nBackup successful")
 	},
 }
+
+func printDryRunReport(name string, report *backup.DryRunReport) {
+	fmt.Println()
+	utils.BgBlue.Printf("Dry run: %s", name)
+	fmt.Print("\n\n")
+	fmt.Printf("Files: %d, total size: %s\n\n", report.Files, utils.FormatBytes(report.TotalSize))
+
+	if len(report.TopLevel) > 0 {
+		w := table.NewWriter()
+		w.AppendHeader(table.Row{"DIRECTORY", "FILES", "SIZE"})
+		for _, e := range report.TopLevel {
+			w.AppendRow(table.Row{e.Path, e.Files, utils.FormatBytes(e.Size)})
+		}
+		fmt.Println(w.Render())
+		fmt.Println()
+	}
+
+	if len(report.Largest) > 0 {
+		w := table.NewWriter()
+		w.AppendHeader(table.Row{"LARGEST FILES", "SIZE"})
+		for _, e := range report.Largest {
+			w.AppendRow(table.Row{e.Path, utils.FormatBytes(e.Size)})
+		}
+		fmt.Println(w.Render())
+		fmt.Println()
+	}
+
+	if r := report.Provider; r != nil {
+		fmt.Printf("Backup program: %d new, %d changed, %d unmodified files. Would be added to the repository: %s\n",
+			r.FilesNew, r.FilesChanged, r.FilesUnmodified, utils.FormatBytes(r.DataAdded))
+	}
+}
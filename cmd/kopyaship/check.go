@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/backup"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+func init() {
+	f := checkCmd.Flags()
+	f.String("read-data-subset", "", "Portion of the data to read and verify (e.g. 5% or 1/10), overriding the config")
+	f.Bool("status", false, "Show results of the previous checks instead of checking")
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check [backups...]",
+	Short: "Check integrity of repositories of backups",
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			f                 = cmd.Flags()
+			readDataSubset, _ = f.GetString("read-data-subset")
+			status, _         = f.GetBool("status")
+			include           = args
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		addExitHandler(cancel)
+		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, debugLog, false, include...)
+		if err != nil {
+			errPrintln(err)
+			exit(exitErrAny)
+		}
+
+		if status {
+			statuses, err := checkStatuses(backups)
+			if err != nil {
+				errPrintln(err)
+				exit(exitErrAny)
+			}
+			printCheckStatuses(statuses)
+			return
+		}
+
+		failed := false
+		for _, name := range sortedBackupNames(backups) {
+			b := backups[name]
+			subset := readDataSubset
+			if !f.Changed("read-data-subset") && b.Config.Check != nil {
+				subset = b.Config.Check.ReadDataSubset
+			}
+			err = b.Check(subset)
+			if err != nil {
+				errPrintln(fmt.Errorf("backup `%s`: %v", name, err))
+				failed = true
+			}
+		}
+		if failed {
+			exit(exitErrAny)
+		}
+		utils.Success.Println("\nCheck successful")
+	},
+}
+
+type checkStatus struct {
+	Backup       string    `json:"backup"`
+	Target       string    `json:"target"`
+	LastCheck    time.Time `json:"last_check"`
+	LastVerified time.Time `json:"last_verified"`
+	Error        string    `json:"error"`
+	// The repository is not verified within `warn_after`.
+	Stale bool `json:"stale"`
+}
+
+func checkStatuses(backups backup.Backups) ([]*checkStatus, error) {
+	statuses := make([]*checkStatus, 0, len(backups))
+	for _, name := range sortedBackupNames(backups) {
+		b := backups[name]
+		s, err := b.State()
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range b.Targets {
+			c := s.Target(target.Name)
+			if len(s.Targets) == 0 && len(b.Targets) == 1 {
+				// Recorded before the results were kept per target.
+				c = &s.Check
+			}
+			status := &checkStatus{
+				Backup:       name,
+				Target:       target.Name,
+				LastCheck:    c.LastCheck,
+				LastVerified: c.LastVerified,
+				Error:        c.LastCheckError,
+			}
+			if c := b.Config.Check; c != nil && c.WarnAfter > 0 {
+				status.Stale = time.Since(status.LastVerified) > c.WarnAfter
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
+
+func printCheckStatuses(statuses []*checkStatus) {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	}
+
+	fmt.Println()
+	w := table.NewWriter()
+	w.AppendHeader(table.Row{
+		"BACKUP", "TARGET", "LAST CHECK", "LAST VERIFIED", "ERROR",
+	})
+	for _, status := range statuses {
+		lastVerified := formatTime(status.LastVerified)
+		if status.Stale {
+			lastVerified = utils.Warn.Sprint(lastVerified)
+		}
+		w.AppendRow(table.Row{
+			status.Backup,
+			status.Target,
+			formatTime(status.LastCheck),
+			lastVerified,
+			utils.Red.Sprint(status.Error),
+		})
+	}
+	fmt.Println(w.Render())
+	fmt.Println()
+}
+
+func sortedBackupNames(backups backup.Backups) []string {
+	names := make([]string, 0, len(backups))
+	for name := range backups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *svc) getCheckStatuses(c echo.Context) error {
+	statuses, err := checkStatuses(s.backups)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, statuses)
+}
+
+// Periodically log the repositories that are not verified recently.
+func (s *svc) warnUnverifiedRepos(ctx context.Context) {
+	warn := func() {
+		statuses, err := checkStatuses(s.backups)
+		if err != nil {
+			s.log.Error(err.Error())
+			return
+		}
+		for _, status := range statuses {
+			if status.Stale {
+				s.log.Sugar().Warnf("Repository of backup `%s` (%s) is not verified recently. Last verified: %s", status.Backup, status.Target, status.LastVerified)
+			}
+		}
+	}
+
+	warn()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			warn()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
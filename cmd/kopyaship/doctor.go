@@ -5,9 +5,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	_config "github.com/tomruk/kopyaship/internal/config"
 	"github.com/tomruk/kopyaship/internal/utils"
 )
 
@@ -18,12 +20,14 @@ var doctorCmd = &cobra.Command{
 		utils.Bold.Println("Doctor:")
 		fmt.Printf("    Using config: %s\n", v.ConfigFileUsed())
 
-		restic, err := exec.LookPath("restic")
-		if err != nil {
-			utils.Warn.Printf("    Warning: restic not found: %v\n", err)
-			errorFound = true
-		} else {
-			fmt.Printf("    restic found at: %s\n", restic)
+		for _, program := range requiredPrograms() {
+			path, err := exec.LookPath(program)
+			if err != nil {
+				utils.Warn.Printf("    Warning: %s not found: %v\n", program, err)
+				errorFound = true
+			} else {
+				fmt.Printf("    %s found at: %s\n", program, path)
+			}
 		}
 
 		lockDir := filepath.Dir(lockFile)
@@ -89,3 +93,33 @@ var doctorCmd = &cobra.Command{
 		}
 	},
 }
+
+// Programs that are used by the backup providers in config.
+// The archive provider doesn't need any program.
+func requiredPrograms() (programs []string) {
+	add := func(program string) {
+		if !slices.Contains(programs, program) {
+			programs = append(programs, program)
+		}
+	}
+	for _, run := range config.Backups.Run {
+		providers := []*_config.Providers{&run.Providers}
+		for _, target := range run.Targets {
+			providers = append(providers, &target.Providers)
+		}
+		for _, p := range providers {
+			for _, name := range p.Configured() {
+				if name != "archive" {
+					add(name)
+				}
+			}
+		}
+	}
+	if len(config.Replication.Run) > 0 {
+		add("restic")
+	}
+	if len(config.Backups.Run) == 0 {
+		add("restic")
+	}
+	return
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/backup"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+func init() {
+	f := forgetCmd.Flags()
+	f.Bool("prune", false, "Remove unreferenced data after forgetting snapshots, regardless of the `prune` option in config")
+}
+
+var forgetCmd = &cobra.Command{
+	Use:   "forget [names...]",
+	Short: "Apply retention policies of backups",
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			f        = cmd.Flags()
+			prune, _ = f.GetBool("prune")
+			include  = args
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		addExitHandler(cancel)
+		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, debugLog, false, include...)
+		if err != nil {
+			errPrintln(err)
+			exit(exitErrAny)
+		}
+
+		for _, backup := range backups {
+			if backup.Config.Retention == nil {
+				// If the backup is explicitly given, complain about it.
+				if len(include) > 0 {
+					errPrintln(fmt.Errorf("no retention policy is set for backup: %s", backup.Name))
+					exit(exitErrAny)
+				}
+				continue
+			}
+
+			err = backup.Forget(prune || backup.Config.Retention.Prune)
+			if err != nil {
+				errPrintln(err)
+				exit(exitErrAny)
+			}
+		}
+
+		utils.Success.Println("\nForget successful")
+	},
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/history"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+func init() {
+	f := historyCmd.Flags()
+	f.String("since", "", "Only show runs started after this. Either a duration (e.g. 24h) or a date (e.g. 2024-03-02)")
+	f.Bool("json", false, "Print history as JSON")
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history [backup]",
+	Short: "Show the history of backup, forget, check and ifile generation runs",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			f             = cmd.Flags()
+			since, _      = f.GetString("since")
+			jsonOutput, _ = f.GetBool("json")
+			filter        = &history.Filter{}
+			err           error
+		)
+		if len(args) == 1 {
+			filter.Name = args[0]
+		}
+		if since != "" {
+			filter.Since, err = parseSince(since)
+			if err != nil {
+				errPrintln(err)
+				exit(exitErrAny)
+			}
+		}
+
+		runs, err := history.Open(stateDir).Runs(filter)
+		if err != nil {
+			errPrintln(err)
+			exit(exitErrAny)
+		}
+
+		if jsonOutput {
+			if runs == nil {
+				runs = []*history.Run{}
+			}
+			e := json.NewEncoder(os.Stdout)
+			e.SetIndent("", "  ")
+			err = e.Encode(runs)
+			if err != nil {
+				errPrintln(err)
+				exit(exitErrAny)
+			}
+			return
+		}
+
+		fmt.Println()
+		w := table.NewWriter()
+		w.AppendHeader(table.Row{
+			"KIND", "NAME", "START", "DURATION", "STATUS", "SNAPSHOT", "ADDED", "FILES",
+		})
+		for _, r := range runs {
+			status := utils.Success.Sprint("success")
+			if !r.Successful() {
+				status = utils.Error.Sprintf("failed (%d): %s", r.ExitStatus, r.Error)
+			}
+			added, files := "", ""
+			if r.BytesAdded > 0 {
+				added = utils.FormatBytes(r.BytesAdded)
+			}
+			if r.FilesProcessed > 0 {
+				files = fmt.Sprint(r.FilesProcessed)
+			}
+			w.AppendRow(table.Row{
+				r.Kind,
+				r.Name,
+				r.Start.Local().Format("2006-01-02 15:04:05"),
+				r.Duration.Round(time.Second),
+				status,
+				r.SnapshotID,
+				added,
+				files,
+			})
+		}
+		fmt.Println(w.Render())
+		fmt.Println()
+	},
+}
+
+func parseSince(since string) (time.Time, error) {
+	d, err := time.ParseDuration(since)
+	if err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339} {
+		t, err := time.ParseInLocation(layout, since, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid `--since`: %s. use a duration (e.g. 24h) or a date (e.g. 2024-03-02)", since)
+}
+
+// Record a run in history. Failing to record doesn't fail the run.
+func recordRun(r *history.Run) {
+	err := history.Open(stateDir).Add(r)
+	if err != nil {
+		debugLog.Sugar().Errorf("Failed to record the %s run of `%s` in history: %v", r.Kind, r.Name, err)
+	}
+}
+
+func (s *svc) recordRun(r *history.Run) {
+	err := history.Open(stateDir).Add(r)
+	if err != nil {
+		s.log.Sugar().Errorf("Failed to record the %s run of `%s` in history: %v", r.Kind, r.Name, err)
+	}
+}
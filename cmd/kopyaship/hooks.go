@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 
+	"github.com/tomruk/kopyaship/internal/backup"
+	"github.com/tomruk/kopyaship/internal/backup/provider"
 	"github.com/tomruk/kopyaship/internal/scripting"
 	"github.com/tomruk/kopyaship/internal/scripting/ctx"
 	"golang.org/x/sync/errgroup"
@@ -31,3 +35,35 @@ func runHook(errGroup *errgroup.Group, command string, c ctx.Context) error {
 		return run()
 	}
 }
+
+// Runs the hooks of b that run after the backup. Post hooks run if the backup is successful,
+// and on_error hooks run if it has failed. Finally hooks run in both cases.
+func runAfterBackupHooks(
+	b *backup.Backup,
+	result *provider.BackupResult,
+	backupErr error,
+	runHooks func(hooks []string, c ctx.Context) error,
+) error {
+	newContext := func(hook string) ctx.Context {
+		return ctx.NewBackupResultContext(hook, b.Name, b.Provider.TargetPath(), b.Config.Base, b.Config.Paths, b.UseIfile, result, backupErr)
+	}
+
+	var errs []error
+	if backupErr == nil {
+		err := runHooks(b.Config.Hooks.Post, newContext(ctx.HookPost))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run post hook: %v", err))
+		}
+	} else {
+		err := runHooks(b.Config.Hooks.OnError, newContext(ctx.HookOnError))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run on_error hook: %v", err))
+		}
+	}
+
+	err := runHooks(b.Config.Hooks.Finally, newContext(ctx.HookFinally))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to run finally hook: %v", err))
+	}
+	return errors.Join(errs...)
+}
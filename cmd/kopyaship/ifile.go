@@ -1,14 +1,28 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
+	_config "github.com/tomruk/kopyaship/internal/config"
+	"github.com/tomruk/kopyaship/internal/history"
 	"github.com/tomruk/kopyaship/internal/ifile"
+	"github.com/tomruk/kopyaship/internal/utils"
 )
 
+func init() {
+	ifileGenerateSyncthingCmd.Flags().Bool("patterns", false, "Translate ignore patterns to syncthing patterns instead of listing every ignored path")
+	ifileGenerateRsyncCmd.Flags().StringP("output", "o", "", "Path of the filter file. Defaults to .rsync-filter in the directory")
+
+	f := ifileExplainCmd.Flags()
+	f.String("root", "", "Directory the ifile is generated from. Defaults to the backup path or the ifile directory in config that contains the path")
+	f.Bool("json", false, "Print explanations as JSON")
+}
+
 var (
 	ifileCmd         = &cobra.Command{Use: "ifile"}
 	ifileGenerateCmd = &cobra.Command{Use: "generate"}
@@ -19,33 +33,142 @@ var (
 		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			dir := args[0]
-			stignore := filepath.Join(dir, ".stignore")
+			mode := ifile.ModeSyncthing
+			if patterns, _ := cmd.Flags().GetBool("patterns"); patterns {
+				mode = ifile.ModeSyncthingPatterns
+			}
+			generateIfile(dir, filepath.Join(dir, ".stignore"), mode)
+		},
+	}
 
-			stat, err := os.Stat(dir)
-			if err != nil {
-				errPrintln(err)
-				exit(exitErrAny)
+	ifileGenerateRsyncCmd = &cobra.Command{
+		Use: "rsync",
+		Long: "Manually generate rsync filter file at the specified directory. Rules are anchored to the directory, " +
+			"so the contents of the directory (<dir>/) should be transferred, with `rsync -F` or `--exclude-from <file>`",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := args[0]
+			output, _ := cmd.Flags().GetString("output")
+			if output == "" {
+				output = filepath.Join(dir, ".rsync-filter")
+			}
+			generateIfile(dir, output, ifile.ModeRsync)
+		},
+	}
+
+	ifileExplainCmd = &cobra.Command{
+		Use:   "explain <path>...",
+		Short: "Show which ignore pattern excludes a path from ifiles",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				f             = cmd.Flags()
+				root, _       = f.GetString("root")
+				jsonOutput, _ = f.GetBool("json")
+				explanations  = make([]*ifile.Explanation, 0, len(args))
+			)
+			if root != "" && !filepath.IsAbs(root) {
+				root = filepath.Join(workDir, root)
 			}
-			if !stat.IsDir() {
-				errPrintln(fmt.Errorf("not a directory: %s", dir))
-				exit(exitErrAny)
+			for _, path := range args {
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(workDir, path)
+				}
+				r, ignore := explainRoot(path)
+				if root != "" {
+					r = root
+				} else if r == "" {
+					errPrintln(fmt.Errorf("%s is not in any backup path or ifile directory in config. set --root", path))
+					exit(exitErrAny)
+				}
+				opts := ifile.DefaultWalkOptions()
+				if ignore != nil {
+					opts = ifile.WalkOptionsFromConfig(ignore)
+				}
+				e, err := ifile.Explain(r, path, opts)
+				if err != nil {
+					errPrintln(err)
+					exit(exitErrAny)
+				}
+				explanations = append(explanations, e)
 			}
 
-			fmt.Printf("Creating/opening %s\n", stignore)
-			ifile, err := ifile.New(stignore, ifile.ModeSyncthing, true, debugLog)
-			if err != nil {
-				errPrintln(err)
-				exit(exitErrAny)
+			if jsonOutput {
+				e := json.NewEncoder(os.Stdout)
+				e.SetIndent("", "  ")
+				err := e.Encode(explanations)
+				if err != nil {
+					errPrintln(err)
+					exit(exitErrAny)
+				}
+				return
 			}
-			defer ifile.Close() // For panic
-			addExitHandler(func() { ifile.Close() })
-
-			fmt.Printf("Walking %s\n", dir)
-			err = ifile.Walk(dir)
-			if err != nil {
-				errPrintln(err)
-				exit(exitErrAny)
+
+			for _, e := range explanations {
+				if e.Ignored {
+					utils.Warn.Print("ignored  ")
+				} else {
+					utils.Success.Print("included ")
+				}
+				fmt.Println(e.Path)
+				if e.Pattern != "" {
+					fmt.Printf("    %s:%d: %s\n", e.Ignorefile, e.Line, e.Pattern)
+				}
+				if e.IgnoredParent != "" {
+					fmt.Printf("    Parent directory %s is ignored\n", e.IgnoredParent)
+				}
 			}
 		},
 	}
 )
+
+// Find the deepest backup path or ifile directory in config that contains the path,
+// along with the ignore config of its backup or ifile generation.
+func explainRoot(path string) (root string, ignore *_config.Ignore) {
+	check := func(r string, i *_config.Ignore) {
+		r = filepath.Clean(r)
+		if (path == r || strings.HasPrefix(path, r+string(filepath.Separator))) && len(r) > len(root) {
+			root = r
+			ignore = i
+		}
+	}
+	for _, run := range config.Backups.Run {
+		for _, p := range run.Paths {
+			check(filepath.Join(run.Base, p), &run.Ignore)
+		}
+	}
+	for _, run := range config.IfileGeneration.Run {
+		check(filepath.Dir(run.Ifile), &run.Ignore)
+	}
+	return
+}
+
+func generateIfile(dir, ifilePath string, mode ifile.Mode) {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		errPrintln(err)
+		exit(exitErrAny)
+	}
+	if !stat.IsDir() {
+		errPrintln(fmt.Errorf("not a directory: %s", dir))
+		exit(exitErrAny)
+	}
+
+	fmt.Printf("Creating/opening %s\n", ifilePath)
+	ifile, err := ifile.New(ifilePath, mode, true, debugLog)
+	if err != nil {
+		errPrintln(err)
+		exit(exitErrAny)
+	}
+	defer ifile.Close() // For panic
+	addExitHandler(func() { ifile.Close() })
+
+	fmt.Printf("Walking %s\n", dir)
+	run := history.Start(history.KindIfile, ifilePath)
+	err = ifile.Walk(dir)
+	recordRun(run.Finish(err))
+	if err != nil {
+		errPrintln(err)
+		exit(exitErrAny)
+	}
+}
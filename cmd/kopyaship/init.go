@@ -6,7 +6,6 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/tomruk/kopyaship/internal/backup"
-	"github.com/tomruk/kopyaship/internal/backup/provider"
 )
 
 var initCmd = &cobra.Command{
@@ -16,7 +15,7 @@ var initCmd = &cobra.Command{
 
 		ctx, cancel := context.WithCancel(context.Background())
 		addExitHandler(cancel)
-		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, debugLog, false, include...)
+		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, debugLog, false, include...)
 		if err != nil {
 			errPrintln(err)
 			exit(exitErrAny)
@@ -36,15 +35,12 @@ var initCmd = &cobra.Command{
 		}
 
 		for _, backup := range backups {
-			restic, ok := backup.Provider.(*provider.Restic)
-			if !ok {
-				errPrintln(fmt.Errorf("backup with name %s is not a restic backup", backup.Name))
-				exit(exitErrAny)
-			}
-			err = restic.Init()
-			if err != nil {
-				errPrintln(err)
-				exit(exitErrAny)
+			for _, target := range backup.Targets {
+				err = target.Provider.Init()
+				if err != nil {
+					errPrintln(err)
+					exit(exitErrAny)
+				}
 			}
 		}
 	},
@@ -25,6 +25,8 @@ var (
 	configDir string
 	stateDir  string
 	cacheDir  string
+	// Working directory kopyaship is started in. initConfig changes it to configDir.
+	workDir string
 
 	config *_config.Config
 	v      *viper.Viper
@@ -39,6 +41,12 @@ func main() { rootCmd.Execute() }
 func init() {
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(forgetCmd)
+	rootCmd.AddCommand(snapshotsCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(replicateCmd)
+	rootCmd.AddCommand(historyCmd)
 	rootCmd.AddCommand(pingCmd)
 	rootCmd.AddCommand(watchJobCmd)
 	watchJobCmd.AddCommand(watchJobListCmd)
@@ -49,7 +57,9 @@ func init() {
 	serviceCmd.AddCommand(serviceReloadCmd)
 	rootCmd.AddCommand(ifileCmd)
 	ifileCmd.AddCommand(ifileGenerateCmd)
+	ifileCmd.AddCommand(ifileExplainCmd)
 	ifileGenerateCmd.AddCommand(ifileGenerateSyncthingCmd)
+	ifileGenerateCmd.AddCommand(ifileGenerateRsyncCmd)
 
 	rootCmd.PersistentFlags().StringP("config", "c", "", "Config file")
 	rootCmd.PersistentFlags().Bool("enable-log", false, "Enable debug logging to stdout")
@@ -124,7 +134,11 @@ var initEverything = sync.OnceValue(func() error {
 	if err != nil {
 		return err
 	}
-	return config.PlaceEnvironmentVariables()
+	err = config.PlaceEnvironmentVariables()
+	if err != nil {
+		return err
+	}
+	return initNotifiers()
 })
 
 func initConfig(userConfigDir, systemConfigDir string) (systemWide bool, err error) {
@@ -134,6 +148,10 @@ func initConfig(userConfigDir, systemConfigDir string) (systemWide bool, err err
 		return false, err
 	}
 	configDir = filepath.Dir(v.ConfigFileUsed())
+	workDir, err = os.Getwd()
+	if err != nil {
+		return false, err
+	}
 	err = os.Chdir(configDir)
 	return
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+	"github.com/tomruk/kopyaship/internal/history"
+	"github.com/tomruk/kopyaship/internal/notify"
+)
+
+// Notifiers of the `notifications` section of config. Initialized by initEverything.
+var notifiers *notify.Notifiers
+
+func initNotifiers() (err error) {
+	notifiers, err = notify.FromConfig(&config.Notifications)
+	return
+}
+
+// Sending is stopped when ctx is canceled, e.g. on exit.
+func sendNotification(ctx context.Context, n *notify.Notification) error {
+	return notifiers.Notify(ctx, n)
+}
+
+func notifyBackup(ctx context.Context, name string, result *provider.BackupResult, err error) error {
+	if err != nil {
+		return sendNotification(ctx, notify.BackupFailed(name, err))
+	}
+	return sendNotification(ctx, notify.BackupSucceeded(name, result))
+}
+
+func (s *svc) notify(ctx context.Context, n *notify.Notification) {
+	err := sendNotification(ctx, n)
+	if err != nil {
+		s.log.Sugar().Errorf("Failed to send %s notification: %v", n.Event, err)
+	}
+}
+
+// Notify once for each backup that hasn't succeeded for `stale_after`.
+// Backups that have never succeeded are not considered stale.
+func (s *svc) notifyStaleBackups(ctx context.Context) {
+	staleAfter := config.Notifications.StaleAfter
+	if staleAfter <= 0 {
+		return
+	}
+
+	notified := make(map[string]bool)
+	check := func() {
+		for _, run := range config.Backups.Run {
+			runs, err := history.Open(stateDir).Runs(&history.Filter{Name: run.Name})
+			if err != nil {
+				s.log.Error(err.Error())
+				return
+			}
+			var lastSuccess time.Time
+			for _, r := range runs {
+				if r.Kind == history.KindBackup && r.Successful() && r.End.After(lastSuccess) {
+					lastSuccess = r.End
+				}
+			}
+
+			if lastSuccess.IsZero() || time.Since(lastSuccess) < staleAfter {
+				delete(notified, run.Name)
+				continue
+			}
+			if !notified[run.Name] {
+				notified[run.Name] = true
+				s.notify(ctx, notify.BackupStale(run.Name, lastSuccess))
+			}
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/backup"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+var replicateCmd = &cobra.Command{
+	Use:   "replicate [names...]",
+	Short: "Copy snapshots between restic repositories",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		addExitHandler(cancel)
+		replications, err := backup.ReplicationsFromConfig(ctx, &config.Replication, debugLog, false, args...)
+		if err != nil {
+			errPrintln(err)
+			exit(exitErrAny)
+		}
+
+		for _, name := range sortedReplicationNames(replications) {
+			err = replications[name].Do()
+			if err != nil {
+				errPrintln(err)
+				exit(exitErrAny)
+			}
+		}
+
+		utils.Success.Println("\nReplication successful")
+	},
+}
+
+func sortedReplicationNames(replications backup.Replications) []string {
+	names := make([]string, 0, len(replications))
+	for name := range replications {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/backup"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+func init() {
+	f := restoreCmd.Flags()
+	f.StringP("target", "t", "", "Directory to restore into")
+	f.StringArrayP("include", "i", nil, "Only restore files matching this pattern (can be specified multiple times)")
+	f.Bool("force", false, "Restore even if the target directory is not empty")
+	f.String("from", "", "Name or repository of the backup target to restore from. By default, the first target is used")
+	restoreCmd.MarkFlagRequired("target")
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <backup> [snapshot]",
+	Short: "Restore a snapshot of a backup. If no snapshot is given, the latest one is restored",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			f          = cmd.Flags()
+			target, _  = f.GetString("target")
+			include, _ = f.GetStringArray("include")
+			force, _   = f.GetBool("force")
+			from, _    = f.GetString("from")
+			name       = args[0]
+			snapshotID = "latest"
+		)
+		if len(args) == 2 {
+			snapshotID = args[1]
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		addExitHandler(cancel)
+		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, debugLog, false, name)
+		if err != nil {
+			errPrintln(err)
+			exit(exitErrAny)
+		}
+		b, ok := backups[name]
+		if !ok {
+			errPrintln(fmt.Errorf("backup with name %s could not be found", name))
+			exit(exitErrAny)
+		}
+
+		err = b.Restore(from, snapshotID, target, include, force)
+		if err != nil {
+			errPrintln(err)
+			exit(exitErrAny)
+		}
+		utils.Success.Println("\nRestore successful")
+	},
+}
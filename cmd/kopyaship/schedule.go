@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tomruk/kopyaship/internal/backup"
+	"github.com/tomruk/kopyaship/internal/scheduler"
+	_ctx "github.com/tomruk/kopyaship/internal/scripting/ctx"
+	"github.com/tomruk/kopyaship/internal/state"
+	"golang.org/x/sync/errgroup"
+)
+
+func (s *svc) initScheduler(ctx context.Context) error {
+	s.scheduler = scheduler.New(state.Open(stateDir), s.log)
+
+	for _, run := range config.Backups.Run {
+		if run.Schedule == "" {
+			continue
+		}
+		name := run.Name
+		err := s.scheduler.Add("backup:"+name, run.Schedule, func() error {
+			return s.runScheduledBackup(ctx, name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	replications, err := backup.ReplicationsFromConfig(ctx, &config.Replication, s.log, true)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedReplicationNames(replications) {
+		r := replications[name]
+		if r.Config.Schedule == "" {
+			continue
+		}
+		err := s.scheduler.Add("replication:"+name, r.Config.Schedule, r.Do)
+		if err != nil {
+			return err
+		}
+	}
+
+	go s.scheduler.Run(ctx)
+	return nil
+}
+
+// Run the backup with its hooks, as `kopyaship backup` does.
+func (s *svc) runScheduledBackup(ctx context.Context, name string) error {
+	// Providers keep per-run state (e.g. the directory of an rsync snapshot).
+	// Create a new backup for every run.
+	backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, s.log, true, name)
+	if err != nil {
+		return err
+	}
+	b, ok := backups[name]
+	if !ok {
+		return fmt.Errorf("backup is skipped: %s", name)
+	}
+
+	runHooks := func(hooks []string, c _ctx.Context) error {
+		errGroup := &errgroup.Group{}
+		for _, hook := range hooks {
+			err := runHook(errGroup, hook, c)
+			if err != nil {
+				return err
+			}
+		}
+		return errGroup.Wait()
+	}
+
+	skip := false
+	err = runHooks(
+		b.Config.Hooks.Pre,
+		_ctx.NewBackupContext(true, b.Name, b.Provider.TargetPath(), b.Config.Base, b.Config.Paths, func() { skip = true }, b.UseIfile),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run pre hook: %v", err)
+	}
+	if skip {
+		s.log.Sugar().Infof("Skipping backup: %s", b.Name)
+		return nil
+	}
+
+	result, backupErr := b.Do()
+	err = notifyBackup(ctx, b.Name, result, backupErr)
+	if err != nil {
+		s.log.Sugar().Errorf("Failed to send notification of backup `%s`: %v", b.Name, err)
+	}
+	err = runAfterBackupHooks(b, result, backupErr, runHooks)
+	return errors.Join(backupErr, err)
+}
+
+func (s *svc) getSchedule(c echo.Context) error {
+	entries, err := s.scheduler.Entries()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, entries)
+}
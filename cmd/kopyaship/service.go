@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,7 +17,10 @@ import (
 	"github.com/kardianos/service"
 	"github.com/labstack/echo/v4"
 	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/backup"
 	"github.com/tomruk/kopyaship/internal/ifile"
+	"github.com/tomruk/kopyaship/internal/notify"
+	"github.com/tomruk/kopyaship/internal/scheduler"
 	"github.com/tomruk/kopyaship/internal/utils"
 	"go.uber.org/zap"
 )
@@ -90,6 +94,9 @@ type svc struct {
 	watchJobs []*ifile.WatchJob
 	jobsMu    sync.Mutex
 
+	backups   backup.Backups
+	scheduler *scheduler.Scheduler
+
 	e *echo.Echo
 	s *http.Server
 }
@@ -115,6 +122,17 @@ func (s *svc) Start(sv service.Service) (err error) {
 			return
 		}
 
+		ctx, cancel := context.WithCancel(context.Background())
+		addExitHandler(cancel)
+		s.backups = s.loadBackups(ctx)
+		go s.warnUnverifiedRepos(ctx)
+		go s.notifyStaleBackups(ctx)
+
+		err = s.initScheduler(ctx)
+		if err != nil {
+			return
+		}
+
 		if config.Service.API.Enabled {
 			var listen func() error
 			s.e, s.s, listen, err = s.newAPIServer()
@@ -143,6 +161,7 @@ func (s *svc) Start(sv service.Service) (err error) {
 			go func(j *ifile.WatchJob) {
 				err := j.Run()
 				if err != nil {
+					s.notify(ctx, notify.WatchJobFailed(j.Ifile(), err))
 					s.appendErr(fmt.Errorf("watch job: %v", err))
 					err := sv.Stop()
 					if err != nil {
@@ -156,6 +175,21 @@ func (s *svc) Start(sv service.Service) (err error) {
 	return
 }
 
+// Create the backups one by one, so that a backup that can't be created (e.g. its path is on
+// an unmounted drive) doesn't prevent the others and the watch jobs from running.
+func (s *svc) loadBackups(ctx context.Context) backup.Backups {
+	backups := make(backup.Backups)
+	for _, run := range config.Backups.Run {
+		b, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, s.log, true, run.Name)
+		if err != nil {
+			s.log.Sugar().Errorf("Skipping backup `%s`: %v", run.Name, err)
+			continue
+		}
+		maps.Copy(backups, b)
+	}
+	return backups
+}
+
 var lockFile = func() string {
 	var lockDir string
 	switch runtime.GOOS {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/backup"
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+)
+
+func init() {
+	f := snapshotsCmd.Flags()
+	f.Bool("json", false, "Print snapshots as JSON")
+	f.String("from", "", "Name or repository of the backup target to list snapshots from. By default, the first target is used")
+}
+
+// Snapshots created from an ifile contain every file in the ifile as a path.
+// Only show this many of them in the table.
+const maxSnapshotPathsShown = 3
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots [backup...]",
+	Short: "List snapshots of backups",
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			f             = cmd.Flags()
+			jsonOutput, _ = f.GetBool("json")
+			from, _       = f.GetString("from")
+			include       = args
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		addExitHandler(cancel)
+		backups, err := backup.FromConfig(ctx, &config.Backups, cacheDir, stateDir, debugLog, false, include...)
+		if err != nil {
+			errPrintln(err)
+			exit(exitErrAny)
+		}
+
+		names := sortedBackupNames(backups)
+		snapshots := make(map[string][]*provider.Snapshot, len(backups))
+		for _, name := range names {
+			target, err := backups[name].Target(from)
+			if err != nil {
+				errPrintln(err)
+				exit(exitErrAny)
+			}
+			s, err := target.Provider.Snapshots()
+			if err != nil {
+				errPrintln(fmt.Errorf("backup `%s`: %v", name, err))
+				exit(exitErrAny)
+			}
+			snapshots[name] = s
+		}
+
+		if jsonOutput {
+			e := json.NewEncoder(os.Stdout)
+			e.SetIndent("", "  ")
+			err = e.Encode(snapshots)
+			if err != nil {
+				errPrintln(err)
+				exit(exitErrAny)
+			}
+			return
+		}
+
+		fmt.Println()
+		w := table.NewWriter()
+		w.AppendHeader(table.Row{
+			"BACKUP", "ID", "TIME", "HOST", "TAGS", "PATHS",
+		})
+		for _, name := range names {
+			for _, s := range snapshots[name] {
+				paths := s.Paths
+				if len(paths) > maxSnapshotPathsShown {
+					paths = append(paths[:maxSnapshotPathsShown:maxSnapshotPathsShown], fmt.Sprintf("(%d more)", len(s.Paths)-maxSnapshotPathsShown))
+				}
+				w.AppendRow(table.Row{
+					name,
+					s.ShortID,
+					s.Time.Local().Format("2006-01-02 15:04:05"),
+					s.Hostname,
+					strings.Join(s.Tags, "\n"),
+					strings.Join(paths, "\n"),
+				})
+			}
+		}
+		fmt.Println(w.Render())
+		fmt.Println()
+	},
+}
@@ -7,10 +7,12 @@ import (
 	"io"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/labstack/echo/v4"
 	"github.com/spf13/cobra"
+	"github.com/tomruk/kopyaship/internal/history"
 	"github.com/tomruk/kopyaship/internal/ifile"
 	"github.com/tomruk/kopyaship/internal/scripting/ctx"
 	"github.com/tomruk/kopyaship/internal/utils"
@@ -172,21 +174,18 @@ func (s *svc) initWatchJobs() (jobs []*ifile.WatchJob, err error) {
 		runPreHooks := newHookRunner(run.Hooks.Pre, ctx.NewIfileGenerationContext(true, run.Ifile, run.Type))
 		runPostHooks := newHookRunner(run.Hooks.Post, ctx.NewIfileGenerationContext(false, run.Ifile, run.Type))
 
-		var mode ifile.Mode
-		switch run.Type {
-		case "syncthing":
-			mode = ifile.ModeSyncthing
-		default:
-			if run.Type == "" {
-				return nil, fmt.Errorf("empty `type` field. check config")
-			}
-			return nil, fmt.Errorf("invalid `type` field: %s", run.Type)
+		if run.Type == "" {
+			return nil, fmt.Errorf("empty `type` field. check config")
+		}
+		mode, err := ifile.ParseMode(run.Type)
+		if err != nil {
+			return nil, err
 		}
 
 		var job *ifile.WatchJob
 		s.jobsMu.Lock()
 		for i, j := range s.watchJobs {
-			if run.Ifile == job.Ifile() {
+			if run.Ifile == j.Ifile() {
 				job = j
 				s.watchJobs = append(s.watchJobs[:i], s.watchJobs[i+1:]...)
 				break
@@ -201,6 +200,13 @@ func (s *svc) initWatchJobs() (jobs []*ifile.WatchJob, err error) {
 		}
 
 		job = ifile.NewWatchJob(run.Ifile, filepath.Dir(run.Ifile), mode, runPreHooks, runPostHooks, s.log)
+		job.SetWalkOptions(ifile.WalkOptionsFromConfig(&run.Ignore))
+		ifilePath := run.Ifile
+		job.OnWalk(func(start time.Time, err error) {
+			r := history.Start(history.KindIfile, ifilePath)
+			r.Start = start
+			s.recordRun(r.Finish(err))
+		})
 
 		jobs = append(jobs, job)
 		s.jobsMu.Lock()
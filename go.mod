@@ -3,24 +3,28 @@ module github.com/tomruk/kopyaship
 go 1.21
 
 require (
+	filippo.io/age v1.1.1
 	github.com/TwiN/go-choice v1.2.0
 	github.com/fatih/color v1.16.0
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gofrs/flock v0.8.1
 	github.com/jedib0t/go-pretty/v6 v6.5.4
 	github.com/kardianos/service v1.2.2
+	github.com/klauspost/compress v1.17.7
 	github.com/labstack/echo/v4 v4.11.4
 	github.com/mattn/go-shellwords v1.0.12
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/rakyll/statik v0.1.7
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/viper v1.15.0
 	github.com/stretchr/testify v1.9.0
 	github.com/tomruk/finddirs-go v0.1.0
 	github.com/tomruk/go-pathspec v0.1.0
 	github.com/traefik/yaegi v0.16.0
+	go.etcd.io/bbolt v1.3.9
 	go.uber.org/zap v1.21.0
-	golang.org/x/sync v0.1.0
+	golang.org/x/sync v0.5.0
 	golang.org/x/term v0.18.0
 	golang.org/x/text v0.14.0
 )
@@ -2,8 +2,11 @@ package backup
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"go.uber.org/zap"
@@ -11,6 +14,9 @@ import (
 
 	"github.com/tomruk/kopyaship/internal/backup/provider"
 	"github.com/tomruk/kopyaship/internal/config"
+	"github.com/tomruk/kopyaship/internal/history"
+	"github.com/tomruk/kopyaship/internal/ifile"
+	"github.com/tomruk/kopyaship/internal/state"
 	"github.com/tomruk/kopyaship/internal/utils"
 )
 
@@ -20,25 +26,39 @@ type (
 	Backup struct {
 		asService bool
 		log       *zap.Logger
+		state     *state.State
+		history   *history.History
 		Config    *config.BackupRun
 
-		Name     string
+		Name string
+		// Provider of the first target. Unless another target is chosen
+		// (see Target), snapshots are listed and restored from this target.
 		Provider provider.Provider
+		// All repositories this backup is written to, including Provider.
+		Targets  []*Target
 		UseIfile bool
 
 		Paths *paths
 	}
+
+	Target struct {
+		Name     string
+		Provider provider.Provider
+	}
 )
 
 func FromConfig(
 	ctx context.Context,
 	configBackups *config.Backups,
 	cacheDir string,
+	stateDir string,
 	log *zap.Logger,
 	asService bool,
 	include ...string,
 ) (backups Backups, err error) {
 	backups = make(Backups)
+	state := state.Open(stateDir)
+	history := history.Open(stateDir)
 
 	if len(include) > 0 {
 		for _, include := range include {
@@ -70,7 +90,7 @@ func FromConfig(
 			}
 		}
 
-		backup, skip, err := fromConfig(ctx, run, cacheDir, log, asService)
+		backup, skip, err := fromConfig(ctx, run, cacheDir, state, history, log, asService)
 		if skip {
 			utils.Warn.Print("Skipping backup: ")
 			fmt.Println(run.Name)
@@ -88,15 +108,24 @@ func fromConfig(
 	ctx context.Context,
 	config *config.BackupRun,
 	cacheDir string,
+	state *state.State,
+	history *history.History,
 	log *zap.Logger,
 	asService bool,
 ) (backup *Backup, skip bool, err error) {
+	targets, err := newTargets(ctx, config, cacheDir, log)
+	if err != nil {
+		return nil, false, err
+	}
 	backup = &Backup{
 		asService: asService,
 		log:       log,
+		state:     state,
+		history:   history,
 		Config:    config,
 		Name:      config.Name,
-		Provider:  provider.NewRestic(ctx, config.Restic.Repo, config.Restic.ExtraArgs, config.Restic.Password, config.Restic.Sudo, log),
+		Provider:  targets[0].Provider,
+		Targets:   targets,
 		UseIfile:  config.UseIfile,
 	}
 
@@ -105,60 +134,371 @@ func fromConfig(
 		cacheDir: cacheDir,
 		backup:   backup,
 		base:     config.Base,
-		paths:    config.Paths,
+		// check joins the paths with the base path. Don't modify the config,
+		// as backups might be created from it again.
+		paths: slices.Clone(config.Paths),
 	}
 	err = backup.Paths.check()
 	if err != nil {
 		return nil, false, err
 	}
+	for _, target := range targets {
+		if r, ok := target.Provider.(*provider.Rsync); ok {
+			r.SetPaths(backup.Paths.Paths())
+		}
+	}
+	return
+}
+
+func newTargets(ctx context.Context, config *config.BackupRun, cacheDir string, log *zap.Logger) (targets []*Target, err error) {
+	if len(config.Providers.Configured()) > 0 || len(config.Targets) == 0 {
+		p, err := newProvider(ctx, config.Name, &config.Providers, cacheDir, log)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, &Target{Name: p.TargetPath(), Provider: p})
+	}
+	for i, target := range config.Targets {
+		p, err := newProvider(ctx, config.Name, &target.Providers, cacheDir, log)
+		if err != nil {
+			return nil, fmt.Errorf("target %d: %v", i+1, err)
+		}
+		name := target.Name
+		if name == "" {
+			name = p.TargetPath()
+		}
+		targets = append(targets, &Target{Name: name, Provider: p})
+	}
 	return
 }
 
-func (b *Backup) Do() error {
-	if !b.UseIfile {
-		paths := b.Paths.Paths()
+func newProvider(ctx context.Context, name string, config *config.Providers, cacheDir string, log *zap.Logger) (p provider.Provider, err error) {
+	if c := config.Restic; c != nil {
+		r := provider.NewRestic(ctx, c.Repo, c.ExtraArgs, c.Password, c.Sudo, log)
+		r.SetBackupName(name)
+		p = r
+	}
+	if c := config.Borg; c != nil {
+		p = provider.NewBorg(ctx, c.Repo, c.ExtraArgs, c.Password, c.Encryption, c.Prefix(name), c.Sudo, log)
+	}
+	if c := config.Kopia; c != nil {
+		p = provider.NewKopia(ctx, c.Repo, c.ExtraArgs, c.Password, filepath.Join(cacheDir, "kopia"), c.Sudo, log)
+	}
+	if c := config.Rsync; c != nil {
+		p = provider.NewRsync(ctx, c.Dest, c.ExtraArgs, c.Sudo, c.Delete, c.LinkDest, log)
+	}
+	if c := config.Archive; c != nil {
+		p = provider.NewArchive(ctx, c.Dir, name, c.Format, c.Password, log)
+	}
+
+	switch configured := config.Configured(); len(configured) {
+	case 0:
+		return nil, fmt.Errorf("no backup provider is configured. set one of: restic, borg, kopia, rsync, archive")
+	case 1:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("multiple backup providers are configured: %s. only one of them can be set", strings.Join(configured, ", "))
+	}
+}
+
+// Target returns the target with the given name or repository path.
+// If name is empty, the first target is returned.
+func (b *Backup) Target(name string) (*Target, error) {
+	if name == "" {
+		return b.Targets[0], nil
+	}
+	for _, target := range b.Targets {
+		if target.Name == name || target.Provider.TargetPath() == name {
+			return target, nil
+		}
+	}
+	return nil, fmt.Errorf("backup `%s` has no target: %s", b.Name, name)
+}
+
+// Do backs up the paths to all targets. Result is the result of the first
+// target that is backed up successfully.
+func (b *Backup) Do() (*provider.BackupResult, error) {
+	run := history.Start(history.KindBackup, b.Name)
+	result, err := b.do()
+	run.Finish(err)
+	if result != nil {
+		run.SnapshotID = result.SnapshotID
+		run.BytesAdded = result.DataAdded
+		run.FilesProcessed = result.FilesProcessed
+	}
+	b.record(run)
+	return result, err
+}
+
+func (b *Backup) do() (result *provider.BackupResult, err error) {
+	// The ifile is generated once, and used for all targets.
+	if b.UseIfile && b.needsIfile() {
+		err := b.Paths.generateIfile()
+		defer os.Remove(b.Paths.ifilePath())
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		if len(paths) > 1 {
-			_, isRestic := b.Provider.(*provider.Restic)
-			if !b.asService && isRestic && !b.Provider.PasswordIsSet() {
-				fmt.Printf("Enter password for the repository %s: ", b.Provider.TargetPath())
-				password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	var errs []error
+	for _, target := range b.Targets {
+		if len(b.Targets) > 1 {
+			b.log.Sugar().Infof("Target: %s", target.Name)
+			if !b.asService {
+				fmt.Println()
+				utils.BgWhite.Printf("Target: %s", target.Name)
 				fmt.Println()
+			}
+		}
+
+		r, err := b.backupTo(target.Provider)
+		if err == nil && b.Config.Retention != nil && b.Config.Retention.AfterBackup {
+			err = b.forget(target, b.Config.Retention.Prune)
+		}
+		if err == nil && result == nil {
+			result = r
+		}
+		if len(b.Targets) == 1 {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		if err != nil {
+			b.log.Sugar().Errorf("Backup `%s` to target %s failed: %v", b.Name, target.Name, err)
+			if !b.asService {
+				utils.Error.Printf("\nBackup to target %s failed: %v\n", target.Name, err)
+			}
+			errs = append(errs, fmt.Errorf("target %s: %v", target.Name, err))
+		} else {
+			b.log.Sugar().Infof("Backup `%s` to target %s is successful", b.Name, target.Name)
+			if !b.asService {
+				utils.Success.Printf("\nBackup to target %s successful\n", target.Name)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		if b.Config.FailOn != config.FailOnAll || len(errs) == len(b.Targets) {
+			return result, errors.Join(errs...)
+		}
+		b.log.Sugar().Warnf("%d of %d targets of backup `%s` failed", len(errs), len(b.Targets), b.Name)
+	}
+	// The backup is successful even if the integrity check that is due fails.
+	// The result of the check is recorded in history and in the state directory.
+	err = b.checkIfDue()
+	if err != nil {
+		b.log.Sugar().Errorf("Check of backup `%s` after the backup failed: %v", b.Name, err)
+		if !b.asService {
+			utils.Error.Printf("\nCheck failed: %v\n", err)
+		}
+	}
+	return result, nil
+}
+
+// Whether any of the targets reads an ifile.
+func (b *Backup) needsIfile() bool {
+	for _, target := range b.Targets {
+		if _, ok := target.Provider.(provider.IgnorefileAware); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Back up to a single target. If multiple snapshots are created, their results are added up.
+func (b *Backup) backupTo(p provider.Provider) (*provider.BackupResult, error) {
+	var bar *progressBar
+	if reporter, ok := p.(provider.ProgressReporter); ok && !b.asService {
+		bar = newProgressBar(os.Stdout)
+		reporter.SetProgress(bar.update)
+		defer reporter.SetProgress(nil)
+	}
+
+	result := &provider.BackupResult{}
+	add := func(r *provider.BackupResult, err error) error {
+		if bar != nil {
+			// Every snapshot has its own progress. End the bar before the next one.
+			bar.done()
+		}
+		if err != nil {
+			return err
+		}
+		if !b.asService {
+			printResult(r)
+		}
+		result.Add(r)
+		return nil
+	}
+
+	if b.UseIfile {
+		if p, ok := p.(provider.IgnorefileAware); ok {
+			opts := ifile.WalkOptionsFromConfig(&b.Config.Ignore)
+			for _, path := range b.Paths.Paths() {
+				b.log.Sugar().Infof("Backup: %s", path)
+				if !b.asService {
+					fmt.Println()
+					utils.BgBlue.Printf("Backup: %s", path)
+					fmt.Println()
+				}
+				// The backup program doesn't read the excludes files of git. Their patterns
+				// come first, so that the patterns of the config take precedence.
+				patterns, err := opts.GitExcludePatterns(path)
 				if err != nil {
-					return err
+					return nil, err
 				}
-
-				err = os.Setenv("RESTIC_PASSWORD", string(password))
+				patterns = append(patterns, opts.Patterns...)
+				err = add(p.BackupWithIgnorefiles(path, opts.Ignorefiles, patterns))
 				if err != nil {
-					return err
+					return nil, err
 				}
-				defer os.Unsetenv("RESTIC_PASSWORD")
 			}
+			return result, nil
+		}
+		err := add(p.BackupWithIfile(b.Paths.ifilePath()))
+		if err != nil {
+			return nil, err
 		}
+		return result, nil
+	}
 
-		for _, path := range paths {
-			b.log.Sugar().Infof("Backup: %s", path)
-			if !b.asService {
-				fmt.Println()
-				utils.BgBlue.Printf("Backup: %s", path)
-				fmt.Println()
+	paths := b.Paths.Paths()
+	if len(paths) > 1 {
+		// Ask the password once, instead of letting the backup program ask it for every path.
+		var passwordEnv string
+		switch p.(type) {
+		case *provider.Restic:
+			passwordEnv = "RESTIC_PASSWORD"
+		case *provider.Borg:
+			passwordEnv = "BORG_PASSPHRASE"
+		}
+		if !b.asService && passwordEnv != "" && !p.PasswordIsSet() {
+			fmt.Printf("Enter password for the repository %s: ", p.TargetPath())
+			password, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			if err != nil {
+				return nil, err
 			}
-			err := b.Provider.Backup(path)
+
+			err = os.Setenv(passwordEnv, string(password))
 			if err != nil {
-				return err
+				return nil, err
 			}
+			defer os.Unsetenv(passwordEnv)
 		}
-	} else {
-		err := b.Paths.generateIfile()
-		defer os.Remove(b.Paths.ifilePath())
+	}
+
+	if p, ok := p.(provider.MultiPathBackuper); ok {
+		b.log.Sugar().Infof("Backup: %s", strings.Join(paths, ", "))
+		if !b.asService {
+			fmt.Println()
+			utils.BgBlue.Printf("Backup: %s", strings.Join(paths, ", "))
+			fmt.Println()
+		}
+		err := add(p.BackupPaths(paths))
 		if err != nil {
-			return err
+			return nil, err
+		}
+		return result, nil
+	}
+	for _, path := range paths {
+		b.log.Sugar().Infof("Backup: %s", path)
+		if !b.asService {
+			fmt.Println()
+			utils.BgBlue.Printf("Backup: %s", path)
+			fmt.Println()
 		}
+		err := add(p.Backup(path))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
 
-		err = b.Provider.BackupWithIfile(b.Paths.ifilePath())
+// Forget applies the retention policy of this backup to all of its targets.
+// If prune is true, unreferenced data is removed afterwards.
+func (b *Backup) Forget(prune bool) error {
+	if b.Config.Retention == nil {
+		return fmt.Errorf("no retention policy is set for backup: %s", b.Name)
+	}
+	run := history.Start(history.KindForget, b.Name)
+	err := b.forgetAll(prune)
+	b.record(run.Finish(err))
+	return err
+}
+
+func (b *Backup) forgetAll(prune bool) error {
+	if len(b.Targets) == 1 {
+		return b.forget(b.Targets[0], prune)
+	}
+
+	var errs []error
+	for _, target := range b.Targets {
+		err := b.forget(target, prune)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("target %s: %v", target.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Backup) forget(target *Target, prune bool) error {
+	r := b.Config.Retention
+	if r == nil {
+		return fmt.Errorf("no retention policy is set for backup: %s", b.Name)
+	}
+
+	retention := &provider.Retention{
+		KeepLast:    r.KeepLast,
+		KeepHourly:  r.KeepHourly,
+		KeepDaily:   r.KeepDaily,
+		KeepWeekly:  r.KeepWeekly,
+		KeepMonthly: r.KeepMonthly,
+		KeepYearly:  r.KeepYearly,
+		KeepTag:     r.KeepTag,
+		KeepWithin:  r.KeepWithin,
+		GroupBy:     r.GroupBy,
+		Paths:       b.Paths.Paths(),
+	}
+	// Paths of a snapshot that is created from an ifile are the files listed in
+	// it, and they change between runs. Grouping by paths would put every such
+	// snapshot into its own group, and nothing would ever be forgotten.
+	if retention.GroupBy == "" && b.UseIfile {
+		retention.GroupBy = "host,tags"
+	}
+
+	b.log.Sugar().Infof("Forget: %s (%s)", b.Name, target.Name)
+	if !b.asService {
+		fmt.Println()
+		utils.BgBlue.Printf("Forget: %s", target.Name)
+		fmt.Println()
+	}
+	err := target.Provider.Forget(retention)
+	if err != nil {
+		return err
+	}
+
+	if prune {
+		b.log.Sugar().Infof("Prune: %s (%s)", b.Name, target.Name)
+		if !b.asService {
+			fmt.Println()
+			utils.BgBlue.Printf("Prune: %s", target.Name)
+			fmt.Println()
 		}
+		return target.Provider.Prune()
 	}
 	return nil
 }
+
+// Record the run in history. Failing to record doesn't fail the run.
+func (b *Backup) record(r *history.Run) {
+	if b.history == nil {
+		return
+	}
+	err := b.history.Add(r)
+	if err != nil {
+		b.log.Sugar().Errorf("Failed to record the %s run of `%s` in history: %v", r.Kind, b.Name, err)
+	}
+}
@@ -3,6 +3,7 @@ package backup
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/tomruk/kopyaship/internal/backup/provider"
 	"github.com/tomruk/kopyaship/internal/config"
+	"github.com/tomruk/kopyaship/internal/state"
 	"github.com/tomruk/kopyaship/internal/utils"
 	"go.uber.org/zap"
 )
@@ -102,10 +104,12 @@ func TestGitignoreToRestic(t *testing.T) {
 			{
 				Name:     "test-gitignore-edge-cases",
 				UseIfile: true,
-				Restic: &config.Restic{
-					Repo:      repoPath,
-					ExtraArgs: extraArgs,
-					Password:  password,
+				Providers: config.Providers{
+					Restic: &config.Restic{
+						Repo:      repoPath,
+						ExtraArgs: extraArgs,
+						Password:  password,
+					},
 				},
 				Base: basePath,
 				Paths: []string{
@@ -115,12 +119,13 @@ func TestGitignoreToRestic(t *testing.T) {
 		},
 	}
 
-	backups, err := FromConfig(context.Background(), configBackups, ".", zap.NewNop(), false)
+	backups, err := FromConfig(context.Background(), configBackups, ".", t.TempDir(), zap.NewNop(), false)
 	require.NoError(t, err)
 	backup := backups["test-gitignore-edge-cases"]
 
-	err = backup.Do()
+	result, err := backup.Do()
 	require.NoError(t, err)
+	require.NotEmpty(t, result.SnapshotID)
 
 	output := bytes.Buffer{}
 	err = testRunRestic(repoPath, "ls -q latest", extraArgs, password, &output)
@@ -224,3 +229,193 @@ func mustCreateDir(path string) {
 		panic(err)
 	}
 }
+
+func TestNewProvider(t *testing.T) {
+	_, err := newProvider(context.Background(), "none", &config.Providers{}, ".", zap.NewNop())
+	require.Error(t, err)
+
+	_, err = newProvider(context.Background(), "multiple", &config.Providers{
+		Restic: &config.Restic{Repo: "/tmp/restic"},
+		Borg:   &config.Borg{Repo: "/tmp/borg"},
+	}, ".", zap.NewNop())
+	require.Error(t, err)
+
+	p, err := newProvider(context.Background(), "borg", &config.Providers{
+		Borg: &config.Borg{Repo: "/tmp/borg"},
+	}, ".", zap.NewNop())
+	require.NoError(t, err)
+	require.IsType(t, &provider.Borg{}, p)
+}
+
+func TestNewTargets(t *testing.T) {
+	targets, err := newTargets(context.Background(), &config.BackupRun{
+		Name: "home",
+		Providers: config.Providers{
+			Restic: &config.Restic{Repo: "/tmp/restic"},
+		},
+		Targets: []*config.Target{
+			{Name: "nas", Providers: config.Providers{Archive: &config.Archive{Dir: "/mnt/nas"}}},
+			{Providers: config.Providers{Borg: &config.Borg{Repo: "/tmp/borg"}}},
+		},
+	}, ".", zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, targets, 3)
+	require.Equal(t, "/tmp/restic", targets[0].Name)
+	require.Equal(t, "nas", targets[1].Name)
+	require.IsType(t, &provider.Archive{}, targets[1].Provider)
+	require.Equal(t, "/tmp/borg", targets[2].Name)
+
+	// Targets alone are enough.
+	targets, err = newTargets(context.Background(), &config.BackupRun{
+		Name:    "home",
+		Targets: []*config.Target{{Providers: config.Providers{Borg: &config.Borg{Repo: "/tmp/borg"}}}},
+	}, ".", zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+
+	_, err = newTargets(context.Background(), &config.BackupRun{
+		Name:    "home",
+		Targets: []*config.Target{{Name: "empty"}},
+	}, ".", zap.NewNop())
+	require.Error(t, err)
+}
+
+type failingProvider struct {
+	provider.Provider
+	backups int
+	err     error
+}
+
+func (p *failingProvider) TargetPath() string { return "/failing" }
+
+func (p *failingProvider) Backup(path string) (*provider.BackupResult, error) {
+	p.backups++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &provider.BackupResult{SnapshotID: "1a2b3c4d"}, nil
+}
+
+func (p *failingProvider) Check(readDataSubset string) error { return p.err }
+
+func TestDoFailOn(t *testing.T) {
+	for _, tc := range []struct {
+		failOn  string
+		errs    []error
+		wantErr bool
+	}{
+		{failOn: "", errs: []error{nil, nil}, wantErr: false},
+		{failOn: "", errs: []error{nil, errors.New("unreachable")}, wantErr: true},
+		{failOn: config.FailOnAll, errs: []error{nil, errors.New("unreachable")}, wantErr: false},
+		{failOn: config.FailOnAll, errs: []error{errors.New("full"), errors.New("unreachable")}, wantErr: true},
+	} {
+		b := &Backup{
+			log:    zap.NewNop(),
+			Config: &config.BackupRun{FailOn: tc.failOn},
+			Name:   "home",
+		}
+		b.Paths = &paths{log: b.log, backup: b, paths: []string{"/home/glenda"}}
+		var providers []*failingProvider
+		for i, err := range tc.errs {
+			p := &failingProvider{err: err}
+			providers = append(providers, p)
+			b.Targets = append(b.Targets, &Target{Name: fmt.Sprint(i), Provider: p})
+		}
+		b.asService = true
+
+		result, err := b.Do()
+		if tc.wantErr {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, "1a2b3c4d", result.SnapshotID)
+		}
+		// A failing target doesn't stop the others.
+		for _, p := range providers {
+			require.Equal(t, 1, p.backups)
+		}
+	}
+}
+
+// Every target is checked, and results are recorded per target.
+func TestCheckTargets(t *testing.T) {
+	b := &Backup{
+		log:    zap.NewNop(),
+		state:  state.Open(t.TempDir()),
+		Config: &config.BackupRun{},
+		Name:   "home",
+		Targets: []*Target{
+			{Name: "local", Provider: &failingProvider{}},
+			{Name: "nas", Provider: &failingProvider{err: errors.New("unreachable")}},
+		},
+		asService: true,
+	}
+	err := b.Check("")
+	require.ErrorContains(t, err, "target nas: unreachable")
+
+	s, err := b.State()
+	require.NoError(t, err)
+	require.Equal(t, "target nas: unreachable", s.LastCheckError)
+	require.True(t, s.LastVerified.IsZero())
+	require.Empty(t, s.Target("local").LastCheckError)
+	require.False(t, s.Target("local").LastVerified.IsZero())
+	require.Equal(t, "unreachable", s.Target("nas").LastCheckError)
+	require.True(t, s.Target("nas").LastVerified.IsZero())
+
+	target, err := b.Target("nas")
+	require.NoError(t, err)
+	require.Equal(t, "nas", target.Name)
+	target, err = b.Target("")
+	require.NoError(t, err)
+	require.Equal(t, "local", target.Name)
+	_, err = b.Target("cloud")
+	require.Error(t, err)
+}
+
+// Backups might be created from the same config multiple times (e.g. by the service).
+func TestFromConfigTwice(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "Documents"), 0755))
+	configBackups := &config.Backups{
+		Run: []*config.BackupRun{
+			{
+				Name:      "home",
+				Providers: config.Providers{Archive: &config.Archive{Dir: t.TempDir()}},
+				Base:      base,
+				Paths:     []string{"Documents"},
+			},
+		},
+	}
+
+	stateDir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		backups, err := FromConfig(context.Background(), configBackups, ".", stateDir, zap.NewNop(), true)
+		require.NoError(t, err)
+		require.Equal(t, []string{filepath.Join(base, "Documents")}, backups["home"].Paths.Paths())
+	}
+	require.Equal(t, []string{"Documents"}, configBackups.Run[0].Paths)
+}
+
+type checkFailingProvider struct{ failingProvider }
+
+func (p *checkFailingProvider) Check(readDataSubset string) error { return errors.New("corrupted") }
+
+// A failing check after a successful backup doesn't fail the backup.
+func TestDoCheckFails(t *testing.T) {
+	b := &Backup{
+		log:       zap.NewNop(),
+		state:     state.Open(t.TempDir()),
+		Config:    &config.BackupRun{Check: &config.Check{Every: 1}},
+		Name:      "home",
+		Targets:   []*Target{{Name: "local", Provider: &checkFailingProvider{}}},
+		asService: true,
+	}
+	b.Paths = &paths{log: b.log, backup: b, paths: []string{"/home/glenda"}}
+
+	result, err := b.Do()
+	require.NoError(t, err)
+	require.Equal(t, "1a2b3c4d", result.SnapshotID)
+	s, err := b.State()
+	require.NoError(t, err)
+	require.Equal(t, "corrupted", s.LastCheckError)
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tomruk/kopyaship/internal/history"
+	"github.com/tomruk/kopyaship/internal/state"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+// Check checks the integrity of the repositories of all targets of this backup,
+// and records the results in the state directory.
+func (b *Backup) Check(readDataSubset string) error {
+	b.log.Sugar().Infof("Check: %s", b.Name)
+	run := history.Start(history.KindCheck, b.Name)
+	var errs []error
+	results := make(map[string]error, len(b.Targets))
+	for _, target := range b.Targets {
+		if !b.asService {
+			fmt.Println()
+			utils.BgBlue.Printf("Check: %s", target.Provider.TargetPath())
+			fmt.Println()
+		}
+		err := target.Provider.Check(readDataSubset)
+		results[target.Name] = err
+		if err != nil {
+			b.log.Sugar().Errorf("Check of backup `%s` on target %s failed: %v", b.Name, target.Name, err)
+			if len(b.Targets) > 1 {
+				err = fmt.Errorf("target %s: %v", target.Name, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	checkErr := errors.Join(errs...)
+	b.record(run.Finish(checkErr))
+
+	err := b.state.UpdateBackup(b.Name, func(s *state.Backup) {
+		now := time.Now()
+		s.RunsSinceCheck = 0
+		s.Record(now, checkErr)
+		if s.Targets == nil {
+			s.Targets = make(map[string]*state.Check, len(results))
+		}
+		for name, err := range results {
+			c, ok := s.Targets[name]
+			if !ok {
+				c = &state.Check{}
+				s.Targets[name] = c
+			}
+			c.Record(now, err)
+		}
+	})
+	if checkErr != nil {
+		return checkErr
+	}
+	return err
+}
+
+// State returns the recorded state of this backup.
+func (b *Backup) State() (*state.Backup, error) { return b.state.Backup(b.Name) }
+
+func (b *Backup) checkIfDue() error {
+	c := b.Config.Check
+	if c == nil || c.Every == 0 {
+		return nil
+	}
+
+	due := false
+	err := b.state.UpdateBackup(b.Name, func(s *state.Backup) {
+		s.RunsSinceCheck++
+		due = s.RunsSinceCheck >= c.Every
+	})
+	if err != nil {
+		return err
+	}
+	if due {
+		return b.Check(c.ReadDataSubset)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package backup
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+)
+
+// Number of the largest files listed in a dry run report.
+const dryRunLargestFiles = 10
+
+type (
+	// DryRunReport summarizes what a backup would send.
+	DryRunReport struct {
+		Files     uint64 `json:"files"`
+		TotalSize uint64 `json:"total_size"`
+		// Largest files, from largest to smallest.
+		Largest []*DryRunEntry `json:"largest"`
+		// Files and sizes under each top-level directory of the backup paths,
+		// from largest to smallest. Files that are directly in a backup path
+		// are counted under the backup path.
+		TopLevel []*DryRunEntry `json:"top_level"`
+		// What the backup program would add to the repository. Only set if it is requested
+		// and the backup program of the first target supports dry runs.
+		Provider *provider.BackupResult `json:"provider,omitempty"`
+	}
+
+	DryRunEntry struct {
+		Path  string `json:"path"`
+		Files uint64 `json:"files"`
+		Size  uint64 `json:"size"`
+	}
+)
+
+// DryRun lists the files this backup would send without touching any repository.
+// If use_ifile is enabled, the ifile is generated as in Do. If save is not empty,
+// the include list is written to it. If runProvider is true, the backup program
+// of the first target is run in its dry run mode, if it supports it.
+func (b *Backup) DryRun(save string, runProvider bool) (report *DryRunReport, err error) {
+	var files []string
+	if b.UseIfile {
+		err = b.Paths.generateIfile()
+		defer os.Remove(b.Paths.ifilePath())
+		if err != nil {
+			return nil, err
+		}
+		files, err = provider.ReadIncludeList(b.Paths.ifilePath())
+	} else {
+		files, err = b.Paths.walk()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if save != "" {
+		err = os.WriteFile(save, []byte(strings.Join(files, "\n")+"\n"), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report, err = b.summarize(files)
+	if err != nil {
+		return nil, err
+	}
+
+	if runProvider {
+		p, ok := b.Provider.(provider.DryRunner)
+		if !ok {
+			return nil, fmt.Errorf("backup program of %s doesn't support dry runs", b.Provider.TargetPath())
+		}
+		report.Provider = &provider.BackupResult{}
+		if b.UseIfile {
+			r, err := p.DryRunWithIfile(b.Paths.ifilePath())
+			if err != nil {
+				return nil, err
+			}
+			report.Provider.Add(r)
+		} else {
+			for _, path := range b.Paths.Paths() {
+				r, err := p.DryRun(path)
+				if err != nil {
+					return nil, err
+				}
+				report.Provider.Add(r)
+			}
+		}
+	}
+	return report, nil
+}
+
+// List all files and empty directories of the paths, as they would be listed in an ifile.
+func (p *paths) walk() (files []string, err error) {
+	for _, root := range p.Paths() {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				entries, err := os.ReadDir(path)
+				if err != nil || len(entries) > 0 {
+					return err
+				}
+			}
+			files = append(files, filepath.ToSlash(path))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func (b *Backup) summarize(files []string) (*DryRunReport, error) {
+	report := &DryRunReport{}
+	topLevel := make(map[string]*DryRunEntry)
+	var all []*DryRunEntry
+
+	for _, file := range files {
+		info, err := os.Lstat(file)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		size := uint64(info.Size())
+		report.Files++
+		report.TotalSize += size
+		all = append(all, &DryRunEntry{Path: file, Files: 1, Size: size})
+
+		dir := b.Paths.topLevel(file)
+		e, ok := topLevel[dir]
+		if !ok {
+			e = &DryRunEntry{Path: dir}
+			topLevel[dir] = e
+		}
+		e.Files++
+		e.Size += size
+	}
+
+	sortBySize := func(entries []*DryRunEntry) {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].Size != entries[j].Size {
+				return entries[i].Size > entries[j].Size
+			}
+			return entries[i].Path < entries[j].Path
+		})
+	}
+	sortBySize(all)
+	report.Largest = all[:min(len(all), dryRunLargestFiles)]
+	for _, e := range topLevel {
+		report.TopLevel = append(report.TopLevel, e)
+	}
+	sortBySize(report.TopLevel)
+	return report, nil
+}
+
+// Returns the top-level directory of file under the backup path that contains it.
+// If file is directly in the backup path, or is the backup path itself, the backup path is returned.
+func (p *paths) topLevel(file string) string {
+	file = filepath.ToSlash(file)
+	for _, root := range p.Paths() {
+		root = filepath.ToSlash(root)
+		if file == root {
+			return root
+		}
+		if rel, ok := strings.CutPrefix(file, root+"/"); ok {
+			if dir, _, ok := strings.Cut(rel, "/"); ok {
+				return root + "/" + dir
+			}
+			return root
+		}
+	}
+	return filepath.ToSlash(filepath.Dir(file))
+}
@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/kopyaship/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestDryRun(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	for path, content := range map[string]string{
+		"documents/.gitignore":       "*.tmp\n",
+		"documents/a":                "12",
+		"documents/b.tmp":            "ignored",
+		"documents/work/report":      "123456",
+		"documents/work/notes":       "1234",
+		"documents/photos/1.jpg":     "1234567890",
+		"documents/photos/2.tmp":     "ignored",
+		"documents/photos/old/2.jpg": "123",
+	} {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "documents/empty"), 0755))
+
+	for _, useIfile := range []bool{true, false} {
+		b := &Backup{
+			log:      zap.NewNop(),
+			Config:   &config.BackupRun{},
+			Name:     "documents",
+			UseIfile: useIfile,
+		}
+		b.Paths = &paths{log: b.log, cacheDir: t.TempDir(), backup: b, paths: []string{dir + "/documents"}}
+
+		save := filepath.Join(t.TempDir(), "include.list")
+		report, err := b.DryRun(save, false)
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(save)
+		require.NoError(t, err)
+		if useIfile {
+			require.Equal(t, uint64(6), report.Files)
+			require.Equal(t, uint64(2+6+4+10+3+len("*.tmp\n")), report.TotalSize)
+			require.NotContains(t, string(content), ".tmp\n")
+		} else {
+			require.Equal(t, uint64(8), report.Files)
+			require.Contains(t, string(content), "b.tmp\n")
+		}
+		require.Contains(t, strings.Split(string(content), "\n"), dir+"/documents/empty")
+
+		require.Equal(t, dir+"/documents/photos/1.jpg", report.Largest[0].Path)
+		require.Equal(t, uint64(10), report.Largest[0].Size)
+
+		// documents/empty has no files.
+		require.Len(t, report.TopLevel, 3)
+		topLevel := make(map[string]*DryRunEntry)
+		for _, e := range report.TopLevel {
+			topLevel[e.Path] = e
+		}
+		require.Equal(t, &DryRunEntry{Path: dir + "/documents/work", Files: 2, Size: 10}, topLevel[dir+"/documents/work"])
+		require.Contains(t, topLevel, dir+"/documents/photos")
+		require.Contains(t, topLevel, dir+"/documents")
+		require.Equal(t, dir+"/documents/photos", report.TopLevel[0].Path)
+		require.Nil(t, report.Provider)
+	}
+}
+
+func TestDryRunUnsupportedProvider(t *testing.T) {
+	dir := t.TempDir()
+	b := &Backup{
+		log:    zap.NewNop(),
+		Config: &config.BackupRun{},
+		Name:   "documents",
+	}
+	b.Provider = &failingProvider{}
+	b.Paths = &paths{log: b.log, backup: b, paths: []string{dir}}
+
+	_, err := b.DryRun("", true)
+	require.ErrorContains(t, err, "doesn't support dry runs")
+}
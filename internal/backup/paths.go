@@ -79,14 +79,21 @@ func (p *paths) ifilePath() string {
 	return filepath.Join(p.cacheDir, p.backup.Name+".list")
 }
 
-func (p *paths) generateIfile() error {
+func (p *paths) generateIfile() (err error) {
 	g, _ := errgroup.WithContext(context.Background())
 
 	i, err := ifile.New(p.ifilePath(), ifile.ModeRestic, false, p.log)
 	if err != nil {
 		return err
 	}
-	defer i.Close()
+	// The ifile is written on Close.
+	defer func() {
+		cerr := i.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	i.SetWalkOptions(ifile.WalkOptionsFromConfig(&p.backup.Config.Ignore))
 
 	for _, path := range p.Paths() {
 		path := path
@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+const (
+	progressBarWidth = 30
+	// Don't redraw the bar more often than this.
+	progressBarInterval = 100 * time.Millisecond
+)
+
+// progressBar renders the progress reported by the backup program on a single line.
+type progressBar struct {
+	w        io.Writer
+	mu       sync.Mutex
+	last     time.Time
+	rendered bool
+}
+
+func newProgressBar(w io.Writer) *progressBar { return &progressBar{w: w} }
+
+func (b *progressBar) update(p *provider.Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Since(b.last) < progressBarInterval && p.PercentDone < 1 {
+		return
+	}
+	b.last = time.Now()
+	b.rendered = true
+	fmt.Fprintf(b.w, "\r%s", renderProgress(p))
+}
+
+// End the line of the bar, if it is rendered.
+func (b *progressBar) done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rendered {
+		fmt.Fprintln(b.w)
+		b.rendered = false
+	}
+}
+
+func renderProgress(p *provider.Progress) string {
+	percent := p.PercentDone
+	if percent > 1 {
+		percent = 1
+	} else if percent < 0 {
+		percent = 0
+	}
+	filled := int(percent * progressBarWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+
+	s := fmt.Sprintf("[%s] %6.2f%%  %s / %s  %d / %d files",
+		bar, percent*100,
+		utils.FormatBytes(p.BytesDone), utils.FormatBytes(p.TotalBytes),
+		p.FilesDone, p.TotalFiles,
+	)
+	if p.SecondsRemaining > 0 {
+		s += fmt.Sprintf("  ETA %s", time.Duration(p.SecondsRemaining)*time.Second)
+	}
+	// Clear the rest of the previous line, which might be longer.
+	return s + "\033[K"
+}
+
+func printResult(r *provider.BackupResult) {
+	if r.SnapshotID != "" {
+		fmt.Printf("Snapshot %s saved\n", r.SnapshotID)
+	}
+	if r.FilesProcessed > 0 {
+		fmt.Printf("Files: %d new, %d changed, %d unmodified\n", r.FilesNew, r.FilesChanged, r.FilesUnmodified)
+	}
+	if r.DataAdded > 0 {
+		fmt.Printf("Added to the repository: %s\n", utils.FormatBytes(r.DataAdded))
+	}
+	fmt.Printf("Took %s\n", r.Duration.Round(time.Second))
+}
@@ -0,0 +1,45 @@
+package backup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+)
+
+func TestRenderProgress(t *testing.T) {
+	s := renderProgress(&provider.Progress{
+		PercentDone:      0.5,
+		FilesDone:        1,
+		TotalFiles:       3,
+		BytesDone:        1024,
+		TotalBytes:       2048,
+		SecondsRemaining: 62,
+	})
+	require.True(t, strings.HasPrefix(s, "["+strings.Repeat("=", 15)+">"+strings.Repeat(" ", 14)+"]  50.00%"))
+	require.Contains(t, s, "1.0 KiB / 2.0 KiB")
+	require.Contains(t, s, "1 / 3 files")
+	require.Contains(t, s, "ETA 1m2s")
+
+	s = renderProgress(&provider.Progress{PercentDone: 1})
+	require.True(t, strings.HasPrefix(s, "["+strings.Repeat("=", progressBarWidth)+"] 100.00%"))
+	require.NotContains(t, s, "ETA")
+}
+
+func TestProgressBar(t *testing.T) {
+	w := &bytes.Buffer{}
+	bar := newProgressBar(w)
+	bar.done()
+	require.Empty(t, w.String())
+
+	bar.update(&provider.Progress{PercentDone: 0.1})
+	// Throttled.
+	bar.update(&provider.Progress{PercentDone: 0.2})
+	// Completion is always rendered.
+	bar.update(&provider.Progress{PercentDone: 1})
+	bar.done()
+	require.Equal(t, 2, strings.Count(w.String(), "\r"))
+	require.True(t, strings.HasSuffix(w.String(), "\n"))
+}
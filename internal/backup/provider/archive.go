@@ -0,0 +1,552 @@
+package provider
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/klauspost/compress/zstd"
+	"github.com/tomruk/kopyaship/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	ArchiveFormatZstd = "tar.zst"
+	ArchiveFormatGzip = "tar.gz"
+
+	archiveTimeLayout = "2006-01-02T15-04-05.000"
+	archiveEncrypted  = ".age"
+)
+
+// Archive writes every backup into a (optionally encrypted) compressed
+// tar archive. It doesn't depend on any external program.
+type Archive struct {
+	ctx  context.Context
+	log  *zap.Logger
+	logS *zap.SugaredLogger
+
+	dir      string
+	prefix   string
+	format   string
+	password string
+}
+
+// Archive names start with prefix.
+func NewArchive(
+	ctx context.Context,
+	dir, prefix, format, password string,
+	log *zap.Logger,
+) *Archive {
+	if format == "" {
+		format = ArchiveFormatZstd
+	}
+	return &Archive{
+		ctx:      ctx,
+		log:      log,
+		logS:     log.Sugar(),
+		dir:      filepath.ToSlash(dir),
+		prefix:   prefix,
+		format:   format,
+		password: password,
+	}
+}
+
+func (a *Archive) TargetPath() string { return a.dir }
+
+func (a *Archive) Init() error { return os.MkdirAll(a.dir, 0755) }
+
+func (a *Archive) Backup(path string) (*BackupResult, error) { return a.BackupPaths([]string{path}) }
+
+// BackupPaths writes all paths into a single archive.
+func (a *Archive) BackupPaths(paths []string) (*BackupResult, error) {
+	return a.write(func(tw *archiveWriter) error {
+		for _, path := range paths {
+			err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					if os.IsPermission(err) {
+						a.logS.Warnf("archive: skipping %s: %v", path, err)
+						return nil
+					}
+					return err
+				}
+				return a.add(tw, path)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (a *Archive) BackupWithIfile(ifile string) (*BackupResult, error) {
+	paths, err := ReadIncludeList(ifile)
+	if err != nil {
+		return nil, err
+	}
+	// Directories in the include list are empty directories.
+	// Their parents are created while restoring.
+	return a.write(func(tw *archiveWriter) error {
+		for _, path := range paths {
+			err := a.add(tw, path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (a *Archive) write(add func(tw *archiveWriter) error) (result *BackupResult, err error) {
+	start := time.Now()
+	name := fmt.Sprintf("%s_%s.%s", a.prefix, start.Format(archiveTimeLayout), a.format)
+	if a.password != "" {
+		name += archiveEncrypted
+	}
+	a.logS.Infof("Writing archive: %s", name)
+
+	f, err := os.CreateTemp(a.dir, name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	var (
+		w       io.Writer = f
+		closers []io.Closer
+	)
+	if a.password != "" {
+		r, err := age.NewScryptRecipient(a.password)
+		if err != nil {
+			return nil, err
+		}
+		e, err := age.Encrypt(w, r)
+		if err != nil {
+			return nil, err
+		}
+		w = e
+		closers = append(closers, e)
+	}
+	switch a.format {
+	case ArchiveFormatZstd:
+		z, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		w = z
+		closers = append(closers, z)
+	case ArchiveFormatGzip:
+		g := gzip.NewWriter(w)
+		w = g
+		closers = append(closers, g)
+	default:
+		return nil, fmt.Errorf("archive: invalid format: %s", a.format)
+	}
+	tw := &archiveWriter{Writer: tar.NewWriter(w)}
+	closers = append(closers, tw)
+
+	err = add(tw)
+	if err != nil {
+		return nil, err
+	}
+	// Close in reverse order, so that everything is flushed to the file.
+	for i := len(closers) - 1; i >= 0; i-- {
+		err = closers[i].Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(a.dir, name)
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	// Every archive is a full backup.
+	return &BackupResult{
+		SnapshotID:     name,
+		FilesNew:       tw.files,
+		FilesProcessed: tw.files,
+		DataAdded:      uint64(info.Size()),
+		Duration:       time.Since(start),
+	}, nil
+}
+
+// Counts the regular files written into the archive.
+type archiveWriter struct {
+	*tar.Writer
+	files uint64
+}
+
+func (a *Archive) add(tw *archiveWriter, path string) error {
+	err := a.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			a.logS.Warnf("archive: skipping %s: %v", path, err)
+			return nil
+		}
+		return err
+	}
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	} else if !info.Mode().IsRegular() && !info.IsDir() {
+		// Devices, sockets, etc.
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	// Like tar, store absolute paths without the leading slash.
+	hdr.Name = strings.TrimPrefix(filepath.ToSlash(utils.StripDriveLetter(path)), "/")
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if !info.Mode().IsRegular() {
+		return tw.WriteHeader(hdr)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			a.logS.Warnf("archive: skipping %s: %v", path, err)
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	// The size in the header is fixed. If the file grows in the meantime, only
+	// that much is copied. If it shrinks, the rest is padded with zeros.
+	n, err := io.CopyN(tw, f, hdr.Size)
+	if err == io.EOF {
+		a.logS.Warnf("archive: %s shrank while it was being read. padding it with zeros", path)
+		_, err = io.CopyN(tw, zeroReader{}, hdr.Size-n)
+	}
+	tw.files++
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// Open the archive with the given name for reading.
+func (a *Archive) open(name string) (tr *tar.Reader, rest io.Reader, close func() error, err error) {
+	f, err := os.Open(filepath.Join(a.dir, name))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	close = f.Close
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, archiveEncrypted) {
+		if a.password == "" {
+			return nil, nil, nil, fmt.Errorf("archive: %s is encrypted, but no password is set", name)
+		}
+		identity, err := age.NewScryptIdentity(a.password)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		r, err = age.Decrypt(r, identity)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("archive: %s: %v", name, err)
+		}
+		name = strings.TrimSuffix(name, archiveEncrypted)
+	}
+
+	switch {
+	case strings.HasSuffix(name, "."+ArchiveFormatZstd):
+		z, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		r = z
+		close = func() error {
+			z.Close()
+			return f.Close()
+		}
+	case strings.HasSuffix(name, "."+ArchiveFormatGzip):
+		g, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		r = g
+	default:
+		return nil, nil, nil, fmt.Errorf("archive: unknown format: %s", name)
+	}
+	return tar.NewReader(r), r, close, nil
+}
+
+func (a *Archive) Forget(retention *Retention) error {
+	if len(retention.KeepTag) > 0 {
+		return fmt.Errorf("archive: keep_tag is not supported")
+	}
+	snapshots, err := a.Snapshots()
+	if err != nil {
+		return err
+	}
+	_, remove, err := retention.apply(snapshots)
+	if err != nil {
+		return err
+	}
+	for _, s := range remove {
+		a.logS.Infof("Removing archive: %s", s.ID)
+		err = os.Remove(filepath.Join(a.dir, s.ID))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removed archives don't leave anything behind. Nothing to prune.
+func (a *Archive) Prune() error { return nil }
+
+// Snapshots returns the archives sorted from oldest to newest.
+func (a *Archive) Snapshots() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(a.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, a.prefix+"_") {
+			continue
+		}
+		t := strings.TrimPrefix(name, a.prefix+"_")
+		t = strings.TrimSuffix(t, archiveEncrypted)
+		t, ok := strings.CutSuffix(t, "."+ArchiveFormatZstd)
+		if !ok {
+			t, ok = strings.CutSuffix(t, "."+ArchiveFormatGzip)
+			if !ok {
+				continue
+			}
+		}
+		created, err := time.ParseInLocation(archiveTimeLayout, t, time.Local)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, &Snapshot{ID: name, ShortID: t, Time: created})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+func (a *Archive) Restore(snapshotID, target string, include []string) error {
+	tr, _, close, err := a.open(snapshotID)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	for {
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive: invalid path in archive: %s", hdr.Name)
+		}
+		if len(include) > 0 && !matchInclude(name, include) {
+			continue
+		}
+		dest := filepath.Join(target, filepath.FromSlash(name))
+		// A symlink that is restored before might point outside of the target.
+		err = checkNoSymlink(target, name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(dest, hdr.FileInfo().Mode().Perm()|0700)
+		case tar.TypeReg:
+			err = restoreFile(dest, hdr, tr)
+		case tar.TypeSymlink:
+			err = os.MkdirAll(filepath.Dir(dest), 0755)
+			if err == nil {
+				os.Remove(dest)
+				err = os.Symlink(hdr.Linkname, dest)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Returns an error if one of the parents of name in target is a symlink.
+func checkNoSymlink(target, name string) error {
+	dir := target
+	parents := strings.Split(name, "/")
+	for _, parent := range parents[:len(parents)-1] {
+		dir = filepath.Join(dir, parent)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("archive: path in archive is under a symlink: %s", name)
+		}
+	}
+	return nil
+}
+
+func restoreFile(dest string, hdr *tar.Header, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	// Don't write to the file a symlink points to.
+	if info, err := os.Lstat(dest); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		err = os.Remove(dest)
+		if err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dest, hdr.AccessTime, hdr.ModTime)
+}
+
+// A path matches the pattern if the path or one of its parents matches it.
+// Patterns without a slash match the name of the path or one of its parents.
+func matchInclude(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+		for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+			subject := p
+			if !strings.Contains(pattern, "/") {
+				subject = path.Base(p)
+			}
+			if ok, _ := path.Match(pattern, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check reads the archives, ensuring they can be decrypted and decompressed.
+// If readDataSubset is given, only that portion of the archives (newest first) is read.
+func (a *Archive) Check(readDataSubset string) error {
+	snapshots, err := a.Snapshots()
+	if err != nil {
+		return err
+	}
+	n := len(snapshots)
+	if readDataSubset != "" {
+		percent, err := readDataPercent(readDataSubset)
+		if err != nil {
+			return fmt.Errorf("archive: %v", err)
+		}
+		n = int(math.Ceil(float64(n) * percent / 100))
+	}
+
+	for i := len(snapshots) - 1; i >= len(snapshots)-n; i-- {
+		a.logS.Infof("Checking archive: %s", snapshots[i].ID)
+		err = a.check(snapshots[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) check(name string) error {
+	tr, rest, close, err := a.open(name)
+	if err != nil {
+		return err
+	}
+	defer close()
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("archive: %s: %v", name, err)
+		}
+		_, err = io.Copy(io.Discard, tr)
+		if err != nil {
+			return fmt.Errorf("archive: %s: %v", name, err)
+		}
+	}
+	// Read the rest, so that checksums at the end of the stream are verified.
+	_, err = io.Copy(io.Discard, rest)
+	if err != nil {
+		return fmt.Errorf("archive: %s: %v", name, err)
+	}
+	return nil
+}
+
+// Password is not asked. If it's not set in config, archives are not encrypted.
+func (a *Archive) PasswordIsSet() bool { return true }
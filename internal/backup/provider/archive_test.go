@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestArchiveRoundtrip(t *testing.T) {
+	for _, tc := range []struct {
+		format   string
+		password string
+	}{
+		{format: ArchiveFormatZstd},
+		{format: ArchiveFormatGzip},
+		{format: ArchiveFormatZstd, password: "toor"},
+	} {
+		t.Run(tc.format+"/"+tc.password, func(t *testing.T) {
+			src := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(src, "docs/empty"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(src, "docs/a.txt"), []byte("a"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("b"), 0600))
+			require.NoError(t, os.Symlink("b.txt", filepath.Join(src, "link")))
+
+			a := NewArchive(context.Background(), filepath.Join(t.TempDir(), "archives"), "home", tc.format, tc.password, zap.NewNop())
+			require.NoError(t, a.Init())
+			result, err := a.BackupPaths([]string{filepath.Join(src, "docs"), filepath.Join(src, "b.txt"), filepath.Join(src, "link")})
+			require.NoError(t, err)
+			require.Equal(t, uint64(2), result.FilesProcessed)
+
+			snapshots, err := a.Snapshots()
+			require.NoError(t, err)
+			require.Len(t, snapshots, 1)
+			require.Equal(t, snapshots[0].ID, result.SnapshotID)
+			require.NoError(t, a.Check(""))
+
+			target := t.TempDir()
+			require.NoError(t, a.Restore(snapshots[0].ID, target, nil))
+			restored := filepath.Join(target, src)
+			content, err := os.ReadFile(filepath.Join(restored, "docs/a.txt"))
+			require.NoError(t, err)
+			require.Equal(t, "a", string(content))
+			info, err := os.Stat(filepath.Join(restored, "b.txt"))
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+			require.DirExists(t, filepath.Join(restored, "docs/empty"))
+			link, err := os.Readlink(filepath.Join(restored, "link"))
+			require.NoError(t, err)
+			require.Equal(t, "b.txt", link)
+
+			target = t.TempDir()
+			require.NoError(t, a.Restore(snapshots[0].ID, target, []string{"*.txt"}))
+			require.FileExists(t, filepath.Join(target, src, "docs/a.txt"))
+			require.NoFileExists(t, filepath.Join(target, src, "link"))
+		})
+	}
+}
+
+func TestArchiveWrongPassword(t *testing.T) {
+	dir := t.TempDir()
+	a := NewArchive(context.Background(), dir, "home", "", "toor", zap.NewNop())
+	_, err := a.Backup(t.TempDir())
+	require.NoError(t, err)
+
+	a = NewArchive(context.Background(), dir, "home", "", "wrong", zap.NewNop())
+	require.Error(t, a.Check(""))
+}
+
+func TestArchiveForget(t *testing.T) {
+	a := NewArchive(context.Background(), t.TempDir(), "home", "", "", zap.NewNop())
+	for _, name := range []string{
+		"home_2024-01-01T10-00-00.000.tar.zst",
+		"home_2024-01-02T10-00-00.000.tar.zst",
+		"home_2024-01-03T10-00-00.000.tar.gz",
+		"other_2024-01-01T10-00-00.000.tar.zst",
+		"home_invalid.tar.zst",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(a.dir, name), nil, 0644))
+	}
+
+	snapshots, err := a.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 3)
+
+	require.NoError(t, a.Forget(&Retention{KeepLast: 1}))
+	snapshots, err = a.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.Equal(t, "home_2024-01-03T10-00-00.000.tar.gz", snapshots[0].ID)
+	require.FileExists(t, filepath.Join(a.dir, "other_2024-01-01T10-00-00.000.tar.zst"))
+}
+
+func TestArchiveRestoreUnderSymlink(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "home_2024-03-02T10-04-05.000.tar.gz"))
+	require.NoError(t, err)
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}))
+	_, err = tw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	require.NoError(t, f.Close())
+
+	a := NewArchive(context.Background(), dir, "home", ArchiveFormatGzip, "", zap.NewNop())
+	err = a.Restore("home_2024-03-02T10-04-05.000.tar.gz", t.TempDir(), nil)
+	require.ErrorContains(t, err, "under a symlink")
+	require.NoFileExists(t, filepath.Join(outside, "passwd"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a = NewArchive(ctx, dir, "home", ArchiveFormatGzip, "", zap.NewNop())
+	require.ErrorIs(t, a.Restore("home_2024-03-02T10-04-05.000.tar.gz", t.TempDir(), nil), context.Canceled)
+}
@@ -0,0 +1,208 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Borg struct {
+	ctx  context.Context
+	log  *zap.Logger
+	logS *zap.SugaredLogger
+
+	repoPath      string
+	extraArgs     string
+	sudo          bool
+	password      string
+	encryption    string
+	archivePrefix string
+}
+
+func NewBorg(
+	ctx context.Context,
+	repoPath, extraArgs, password, encryption, archivePrefix string,
+	sudo bool,
+	log *zap.Logger,
+) *Borg {
+	if encryption == "" {
+		encryption = "repokey"
+	}
+	return &Borg{
+		ctx:           ctx,
+		log:           log,
+		logS:          log.Sugar(),
+		repoPath:      filepath.ToSlash(repoPath),
+		extraArgs:     extraArgs,
+		sudo:          sudo,
+		password:      password,
+		encryption:    encryption,
+		archivePrefix: archivePrefix,
+	}
+}
+
+func (b *Borg) TargetPath() string { return b.repoPath }
+
+func (b *Borg) Init() error {
+	return b.run(fmt.Sprintf("borg init --encryption '%s' '%s'", b.encryption, b.repoPath), nil, nil, "")
+}
+
+// Name of the archive to create. Placeholders are expanded by borg.
+func (b *Borg) archive() string {
+	return fmt.Sprintf("'%s::%s{now:%%Y-%%m-%%dT%%H:%%M:%%S}'", b.repoPath, b.archivePrefix)
+}
+
+func (b *Borg) Backup(path string) (*BackupResult, error) { return b.BackupPaths([]string{path}) }
+
+// BackupPaths creates a single archive of all paths. Archive names have a precision of a second,
+// so creating an archive for every path might fail with a duplicate archive name.
+func (b *Borg) BackupPaths(paths []string) (*BackupResult, error) {
+	command := b.createCommand(paths)
+	return timed(func() error { return b.run(command, nil, nil, "") })
+}
+
+func (b *Borg) createCommand(paths []string) string {
+	command := "borg create"
+	if b.extraArgs != "" {
+		command += " " + b.extraArgs
+	}
+	command += " " + b.archive()
+	for _, path := range paths {
+		command += fmt.Sprintf(" '%s'", filepath.ToSlash(path))
+	}
+	return command
+}
+
+func (b *Borg) BackupWithIfile(ifile string) (*BackupResult, error) {
+	// Borg reads the paths literally; it doesn't understand
+	// comments and escape sequences of the ifile.
+	paths, err := ReadIncludeList(ifile)
+	if err != nil {
+		return nil, err
+	}
+	command := "borg create --paths-from-stdin"
+	if b.extraArgs != "" {
+		command += " " + b.extraArgs
+	}
+	command += " " + b.archive()
+	stdin := strings.NewReader(strings.Join(paths, "\n") + "\n")
+	return timed(func() error { return b.run(command, stdin, nil, "") })
+}
+
+func (b *Borg) Forget(retention *Retention) error {
+	if len(retention.KeepTag) > 0 {
+		return fmt.Errorf("borg: keep_tag is not supported, as borg archives don't have tags")
+	}
+	command := fmt.Sprintf("borg prune --glob-archives '%s*'", b.archivePrefix)
+	keep := func(flag string, n int) {
+		if n > 0 {
+			command += fmt.Sprintf(" --%s %d", flag, n)
+		}
+	}
+	keep("keep-last", retention.KeepLast)
+	keep("keep-hourly", retention.KeepHourly)
+	keep("keep-daily", retention.KeepDaily)
+	keep("keep-weekly", retention.KeepWeekly)
+	keep("keep-monthly", retention.KeepMonthly)
+	keep("keep-yearly", retention.KeepYearly)
+	if retention.KeepWithin != "" {
+		command += fmt.Sprintf(" --keep-within '%s'", retention.KeepWithin)
+	}
+	command += fmt.Sprintf(" '%s'", b.repoPath)
+	return b.run(command, nil, nil, "")
+}
+
+func (b *Borg) Prune() error {
+	return b.run(fmt.Sprintf("borg compact '%s'", b.repoPath), nil, nil, "")
+}
+
+func (b *Borg) Snapshots() ([]*Snapshot, error) {
+	stdout := bytes.Buffer{}
+	err := b.run(fmt.Sprintf("borg list --json --glob-archives '%s*' '%s'", b.archivePrefix, b.repoPath), nil, &stdout, "")
+	if err != nil {
+		return nil, err
+	}
+	return parseBorgList(&stdout)
+}
+
+func parseBorgList(r io.Reader) ([]*Snapshot, error) {
+	var list struct {
+		Archives []struct {
+			Name  string `json:"name"`
+			ID    string `json:"id"`
+			Start string `json:"start"`
+		} `json:"archives"`
+	}
+	err := json.NewDecoder(r).Decode(&list)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse borg archive list: %v", err)
+	}
+
+	snapshots := make([]*Snapshot, 0, len(list.Archives))
+	for _, archive := range list.Archives {
+		// Borg prints local time without time zone.
+		t, err := time.ParseInLocation("2006-01-02T15:04:05.999999", archive.Start, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse time of borg archive %s: %v", archive.Name, err)
+		}
+		// Archives are referred to by their names in borg.
+		snapshots = append(snapshots, &Snapshot{
+			ID:      archive.Name,
+			ShortID: archive.Name,
+			Time:    t,
+		})
+	}
+	return snapshots, nil
+}
+
+func (b *Borg) Restore(snapshotID, target string, include []string) error {
+	// borg extract extracts into the current directory.
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return err
+	}
+	command := fmt.Sprintf("borg extract '%s::%s'", b.repoPath, snapshotID)
+	for _, pattern := range include {
+		// Paths are stored without the leading slash.
+		pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "/")
+		command += fmt.Sprintf(" '%s'", pattern)
+	}
+	return b.run(command, nil, nil, target)
+}
+
+func (b *Borg) Check(readDataSubset string) error {
+	command := "borg check"
+	if readDataSubset != "" {
+		// Borg can't verify a subset of the data.
+		b.logS.Infof("borg: verifying all data instead of %s", readDataSubset)
+		command += " --verify-data"
+	}
+	command += fmt.Sprintf(" '%s'", b.repoPath)
+	return b.run(command, nil, nil, "")
+}
+
+func (b *Borg) PasswordIsSet() bool {
+	return b.password != "" || os.Getenv("BORG_PASSPHRASE") != "" || os.Getenv("BORG_PASSCOMMAND") != ""
+}
+
+func (b *Borg) run(cmd string, stdin io.Reader, stdout io.Writer, dir string) error {
+	c := &command{
+		command: cmd,
+		sudo:    b.sudo,
+		dir:     dir,
+		stdin:   stdin,
+		stdout:  stdout,
+	}
+	if b.password != "" {
+		c.env = append(c.env, "BORG_PASSPHRASE="+b.password)
+	}
+	return c.run(b.ctx, b.logS)
+}
@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseBorgList(t *testing.T) {
+	const output = `{
+    "archives": [
+        {
+            "archive": "StevesComputer-2024-03-02T10:04:05",
+            "barchive": "StevesComputer-2024-03-02T10:04:05",
+            "id": "d3b2d3c0a9e3f1b6f5c1c9a1e8b8e1d2f7b1d3c2a1e9f8d7c6b5a4f3e2d1c0b9",
+            "name": "StevesComputer-2024-03-02T10:04:05",
+            "start": "2024-03-02T10:04:05.000000",
+            "time": "2024-03-02T10:04:05.000000"
+        }
+    ],
+    "encryption": {"mode": "repokey"},
+    "repository": {"id": "0a1b2c", "last_modified": "2024-03-02T10:04:09.000000", "location": "/var/backup/borg"}
+}`
+
+	snapshots, err := parseBorgList(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.Equal(t, "StevesComputer-2024-03-02T10:04:05", snapshots[0].ID)
+	require.True(t, snapshots[0].Time.Equal(time.Date(2024, 3, 2, 10, 4, 5, 0, time.Local)))
+}
+
+func TestBorgCreateCommand(t *testing.T) {
+	b := NewBorg(context.Background(), "/var/backup/borg", "--stats", "", "", "host-", false, zap.NewNop())
+	require.Equal(t,
+		"borg create --stats '/var/backup/borg::host-{now:%Y-%m-%dT%H:%M:%S}' '/home/steve/Documents' '/home/steve/Pictures'",
+		b.createCommand([]string{"/home/steve/Documents", "/home/steve/Pictures"}),
+	)
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+	"go.uber.org/zap"
+)
+
+type command struct {
+	command string
+	sudo    bool
+	// Environment variables in the form of KEY=value.
+	// They are appended to the environment of the current process.
+	env []string
+	// Working directory. If empty, current directory is used.
+	dir string
+	// If nil, os.Stdin is used.
+	stdin io.Reader
+	// If nil, os.Stdout is used.
+	stdout io.Writer
+}
+
+func (c *command) run(ctx context.Context, logS *zap.SugaredLogger) error {
+	parser := shellwords.NewParser()
+	parser.ParseBacktick = true
+	parser.ParseEnv = true
+
+	command := c.command
+	if c.sudo {
+		command = "sudo " + command
+	}
+	logS.Infof("Running: %s", command)
+
+	w, err := parser.Parse(command)
+	if err != nil {
+		return err
+	}
+	if len(w) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	cmd := exec.CommandContext(ctx, w[0], w[1:]...)
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	cmd.Dir = c.dir
+	cmd.Stdin = c.stdin
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = c.stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// ReadIncludeList reads the paths in an include file generated by kopyaship.
+// Comments and empty lines are skipped, and escaped characters are unescaped.
+func ReadIncludeList(ifile string) (paths []string, err error) {
+	f, err := os.Open(ifile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	unescape := strings.NewReplacer(`\[`, "[", `\]`, "]")
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, unescape.Replace(line))
+	}
+	return paths, scanner.Err()
+}
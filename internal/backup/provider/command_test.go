@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadIncludeList(t *testing.T) {
+	ifile := filepath.Join(t.TempDir(), "test.list")
+	err := os.WriteFile(ifile, []byte(`# Generated by kopyaship. DO NOT TOUCH THE LINES BETWEEN I_BEGIN AND I_END.
+# I_BEGIN
+/home/glenda/Documents/a
+/home/glenda/Documents/\[draft\] b
+
+/home/glenda/Documents/c d`+"\r"+`
+# I_END
+`), 0644)
+	require.NoError(t, err)
+
+	paths, err := ReadIncludeList(ifile)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/home/glenda/Documents/a",
+		"/home/glenda/Documents/[draft] b",
+		"/home/glenda/Documents/c d",
+	}, paths)
+}
@@ -0,0 +1,291 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Kopia struct {
+	ctx  context.Context
+	log  *zap.Logger
+	logS *zap.SugaredLogger
+
+	repoPath   string
+	extraArgs  string
+	sudo       bool
+	password   string
+	configFile string
+
+	connectOnce sync.Once
+	connectErr  error
+}
+
+// configDir is where kopia config files, which hold connections
+// to repositories, are stored. Every repository has its own config
+// file, so that connections to different repositories don't clash.
+func NewKopia(
+	ctx context.Context,
+	repoPath, extraArgs, password, configDir string,
+	sudo bool,
+	log *zap.Logger,
+) *Kopia {
+	repoPath = filepath.ToSlash(repoPath)
+	sum := sha256.Sum256([]byte(repoPath))
+	return &Kopia{
+		ctx:        ctx,
+		log:        log,
+		logS:       log.Sugar(),
+		repoPath:   repoPath,
+		extraArgs:  extraArgs,
+		sudo:       sudo,
+		password:   password,
+		configFile: filepath.ToSlash(filepath.Join(configDir, hex.EncodeToString(sum[:8])+".config")),
+	}
+}
+
+func (k *Kopia) TargetPath() string { return k.repoPath }
+
+func (k *Kopia) Init() error {
+	err := os.MkdirAll(filepath.Dir(k.configFile), 0755)
+	if err != nil {
+		return err
+	}
+	// Creating a repository also connects to it.
+	return k.run(fmt.Sprintf("repository create filesystem --path '%s'", k.repoPath), nil)
+}
+
+func (k *Kopia) connect() error {
+	k.connectOnce.Do(func() {
+		if _, err := os.Stat(k.configFile); err == nil {
+			return
+		}
+		k.connectErr = os.MkdirAll(filepath.Dir(k.configFile), 0755)
+		if k.connectErr != nil {
+			return
+		}
+		k.connectErr = k.run(fmt.Sprintf("repository connect filesystem --path '%s'", k.repoPath), nil)
+	})
+	return k.connectErr
+}
+
+func (k *Kopia) Backup(path string) (*BackupResult, error) {
+	err := k.connect()
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.ToSlash(path)
+	command := "snapshot create"
+	if k.extraArgs != "" {
+		command += " " + k.extraArgs
+	}
+	command += fmt.Sprintf(" '%s'", path)
+	return timed(func() error { return k.run(command, nil) })
+}
+
+// Kopia can't read an include list. Use BackupWithIgnorefiles instead.
+func (k *Kopia) BackupWithIfile(ifile string) (*BackupResult, error) {
+	return nil, fmt.Errorf("kopia: backing up from an ifile is not supported. ignore files are applied by kopia itself")
+}
+
+// BackupWithIgnorefiles makes kopia apply the rules of ignore files with
+// the given names and the patterns, then backs up the path. Kopia understands
+// .gitignore syntax, so the result is the same as backing up from an ifile.
+func (k *Kopia) BackupWithIgnorefiles(path string, ignorefiles, patterns []string) (*BackupResult, error) {
+	err := k.connect()
+	if err != nil {
+		return nil, err
+	}
+	path = filepath.ToSlash(path)
+	err = k.run(ignorePolicyCommand(path, ignorefiles, patterns), nil)
+	if err != nil {
+		return nil, err
+	}
+	return k.Backup(path)
+}
+
+// Lists of the policy are cleared first, so that the ones removed from config are not applied anymore.
+func ignorePolicyCommand(path string, ignorefiles, patterns []string) string {
+	command := fmt.Sprintf("policy set '%s' --clear-dot-ignore", path)
+	for _, name := range ignorefiles {
+		command += fmt.Sprintf(" --add-dot-ignore '%s'", name)
+	}
+	command += " --clear-ignore"
+	for _, pattern := range patterns {
+		command += fmt.Sprintf(" --add-ignore '%s'", pattern)
+	}
+	return command
+}
+
+func (k *Kopia) Forget(retention *Retention) error {
+	if len(retention.KeepTag) > 0 {
+		return fmt.Errorf("kopia: keep_tag is not supported")
+	} else if retention.KeepWithin != "" {
+		return fmt.Errorf("kopia: keep_within is not supported")
+	} else if len(retention.Paths) == 0 {
+		return fmt.Errorf("kopia: no paths to apply the retention policy to")
+	}
+	err := k.connect()
+	if err != nil {
+		return err
+	}
+	for _, command := range forgetCommands(retention) {
+		err = k.run(command, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retention is a policy in kopia. It is set only for the paths of the backup, and only
+// their snapshots are expired, so that other sources in the repository are not touched.
+func forgetCommands(retention *Retention) (commands []string) {
+	policy := "policy set"
+	for _, path := range retention.Paths {
+		policy += fmt.Sprintf(" '%s'", filepath.ToSlash(path))
+	}
+	// Every flag is set, as the ones that are not set are inherited from the global policy.
+	keep := func(flag string, n int) {
+		policy += fmt.Sprintf(" --%s %d", flag, n)
+	}
+	keep("keep-latest", retention.KeepLast)
+	keep("keep-hourly", retention.KeepHourly)
+	keep("keep-daily", retention.KeepDaily)
+	keep("keep-weekly", retention.KeepWeekly)
+	keep("keep-monthly", retention.KeepMonthly)
+	keep("keep-annual", retention.KeepYearly)
+	commands = append(commands, policy)
+
+	expire := "snapshot expire"
+	for _, path := range retention.Paths {
+		expire += fmt.Sprintf(" '%s'", filepath.ToSlash(path))
+	}
+	return append(commands, expire+" --delete")
+}
+
+func (k *Kopia) Prune() error {
+	err := k.connect()
+	if err != nil {
+		return err
+	}
+	return k.run("maintenance run --full", nil)
+}
+
+func (k *Kopia) Snapshots() ([]*Snapshot, error) {
+	err := k.connect()
+	if err != nil {
+		return nil, err
+	}
+	stdout := bytes.Buffer{}
+	err = k.run("snapshot list --all --json", &stdout)
+	if err != nil {
+		return nil, err
+	}
+	return parseKopiaSnapshots(&stdout)
+}
+
+func parseKopiaSnapshots(r io.Reader) ([]*Snapshot, error) {
+	var manifests []struct {
+		ID     string `json:"id"`
+		Source struct {
+			Host     string `json:"host"`
+			UserName string `json:"userName"`
+			Path     string `json:"path"`
+		} `json:"source"`
+		StartTime time.Time         `json:"startTime"`
+		Tags      map[string]string `json:"tags"`
+	}
+	err := json.NewDecoder(r).Decode(&manifests)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse kopia snapshot list: %v", err)
+	}
+
+	snapshots := make([]*Snapshot, 0, len(manifests))
+	for _, m := range manifests {
+		shortID := m.ID
+		if len(shortID) > 8 {
+			shortID = shortID[:8]
+		}
+		var tags []string
+		for key, value := range m.Tags {
+			tags = append(tags, strings.TrimPrefix(key, "tag:")+":"+value)
+		}
+		snapshots = append(snapshots, &Snapshot{
+			ID:       m.ID,
+			ShortID:  shortID,
+			Time:     m.StartTime,
+			Hostname: m.Source.Host,
+			Username: m.Source.UserName,
+			Tags:     tags,
+			Paths:    []string{m.Source.Path},
+		})
+	}
+	return snapshots, nil
+}
+
+// Kopia can't filter files while restoring. Instead, include can
+// contain paths relative to the snapshot root, and each of them is
+// restored into its place in the target directory.
+func (k *Kopia) Restore(snapshotID, target string, include []string) error {
+	err := k.connect()
+	if err != nil {
+		return err
+	}
+	target = filepath.ToSlash(target)
+	if len(include) == 0 {
+		return k.run(fmt.Sprintf("snapshot restore '%s' '%s'", snapshotID, target), nil)
+	}
+	for _, path := range include {
+		path = strings.Trim(filepath.ToSlash(path), "/")
+		err = k.run(fmt.Sprintf("snapshot restore '%s/%s' '%s/%s'", snapshotID, path, target, path), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *Kopia) Check(readDataSubset string) error {
+	err := k.connect()
+	if err != nil {
+		return err
+	}
+	command := "snapshot verify"
+	if readDataSubset != "" {
+		percent, err := readDataPercent(readDataSubset)
+		if err != nil {
+			return fmt.Errorf("kopia: %v", err)
+		}
+		command += fmt.Sprintf(" --verify-files-percent %s", strconv.FormatFloat(percent, 'f', -1, 64))
+	}
+	return k.run(command, nil)
+}
+
+func (k *Kopia) PasswordIsSet() bool {
+	return k.password != "" || os.Getenv("KOPIA_PASSWORD") != ""
+}
+
+func (k *Kopia) run(cmd string, stdout io.Writer) error {
+	c := &command{
+		command: fmt.Sprintf("kopia --config-file '%s' %s", k.configFile, cmd),
+		sudo:    k.sudo,
+		stdout:  stdout,
+	}
+	if k.password != "" {
+		c.env = append(c.env, "KOPIA_PASSWORD="+k.password)
+	}
+	return c.run(k.ctx, k.logS)
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKopiaSnapshots(t *testing.T) {
+	const output = `[
+  {
+    "id": "6d5b8c5f1e2a3b4c5d6e7f8091a2b3c4",
+    "source": {"host": "StevesComputer", "userName": "glenda", "path": "/home/glenda/Documents"},
+    "description": "",
+    "startTime": "2024-03-02T07:04:05.123456789Z",
+    "endTime": "2024-03-02T07:04:07.123456789Z",
+    "rootEntry": {"name": "Documents", "type": "d", "obj": "k1a2b3c4"}
+  }
+]`
+
+	snapshots, err := parseKopiaSnapshots(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	s := snapshots[0]
+	require.Equal(t, "6d5b8c5f", s.ShortID)
+	require.Equal(t, "StevesComputer", s.Hostname)
+	require.Equal(t, "glenda", s.Username)
+	require.Equal(t, []string{"/home/glenda/Documents"}, s.Paths)
+	require.True(t, s.Time.Equal(time.Date(2024, 3, 2, 7, 4, 5, 123456789, time.UTC)))
+}
+
+func TestIgnorePolicyCommand(t *testing.T) {
+	require.Equal(t,
+		"policy set '/home/user/documents' --clear-dot-ignore --add-dot-ignore '.gitignore' --add-dot-ignore '.ksignore' --clear-ignore --add-ignore '*.iso' --add-ignore '!keep.iso'",
+		ignorePolicyCommand("/home/user/documents", []string{".gitignore", ".ksignore"}, []string{"*.iso", "!keep.iso"}),
+	)
+	require.Equal(t,
+		"policy set '/home/user/documents' --clear-dot-ignore --clear-ignore",
+		ignorePolicyCommand("/home/user/documents", nil, nil),
+	)
+}
+
+func TestKopiaForgetCommands(t *testing.T) {
+	require.Equal(t,
+		[]string{
+			"policy set '/home/user/documents' '/home/user/pictures' --keep-latest 3 --keep-hourly 0 --keep-daily 0 --keep-weekly 0 --keep-monthly 0 --keep-annual 2",
+			"snapshot expire '/home/user/documents' '/home/user/pictures' --delete",
+		},
+		forgetCommands(&Retention{KeepLast: 3, KeepYearly: 2, Paths: []string{"/home/user/documents", "/home/user/pictures"}}),
+	)
+}
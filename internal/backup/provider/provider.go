@@ -1,9 +1,152 @@
 package provider
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Provider interface {
 	Init() error
 	TargetPath() string
-	Backup(path string) error
-	BackupWithIfile(ifile string) error
+	Backup(path string) (*BackupResult, error)
+	BackupWithIfile(ifile string) (*BackupResult, error)
+	// Remove snapshots that are not kept by the retention policy.
+	Forget(retention *Retention) error
+	// Remove data that is not referenced by any snapshot.
+	Prune() error
+	Snapshots() ([]*Snapshot, error)
+	// Restore the snapshot with the given ID into target directory.
+	// If include is not empty, only the matching files are restored.
+	Restore(snapshotID, target string, include []string) error
+	// Check the integrity of the repository. If readDataSubset is not empty,
+	// that portion of the data is also read and verified.
+	Check(readDataSubset string) error
 	PasswordIsSet() bool
 }
+
+// IgnorefileAware is implemented by providers that can't read an ifile,
+// but can apply the rules of ignore files (.gitignore, .ksignore) by themselves.
+type IgnorefileAware interface {
+	// ignorefiles are the names of the ignore files. patterns are in gitignore
+	// format, and apply at the root of the path.
+	BackupWithIgnorefiles(path string, ignorefiles, patterns []string) (*BackupResult, error)
+}
+
+// MultiPathBackuper is implemented by providers that can back up all paths
+// of a backup into a single snapshot.
+type MultiPathBackuper interface {
+	BackupPaths(paths []string) (*BackupResult, error)
+}
+
+// DryRunner is implemented by providers that can report what a backup would
+// add to the repository, without writing anything to it.
+type DryRunner interface {
+	DryRun(path string) (*BackupResult, error)
+	DryRunWithIfile(ifile string) (*BackupResult, error)
+}
+
+// ProgressReporter is implemented by providers that report the progress of backups.
+type ProgressReporter interface {
+	// f is called whenever the backup program reports progress. If nil, progress is not reported.
+	SetProgress(f func(p *Progress))
+}
+
+type Progress struct {
+	// Between 0 and 1.
+	PercentDone      float64
+	FilesDone        uint64
+	TotalFiles       uint64
+	BytesDone        uint64
+	TotalBytes       uint64
+	SecondsRemaining uint64
+}
+
+// BackupResult describes the outcome of a backup. Stats that the backup
+// program doesn't report are left as zero.
+type BackupResult struct {
+	// If multiple snapshots are created, their IDs are separated by commas.
+	SnapshotID      string `json:"snapshot_id,omitempty"`
+	FilesNew        uint64 `json:"files_new"`
+	FilesChanged    uint64 `json:"files_changed"`
+	FilesUnmodified uint64 `json:"files_unmodified"`
+	// Number of files that are backed up, including unmodified ones.
+	FilesProcessed uint64 `json:"files_processed"`
+	// Bytes added to the repository.
+	DataAdded uint64        `json:"data_added"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Add adds the stats of other to r. It is used when a backup consists of multiple snapshots.
+func (r *BackupResult) Add(other *BackupResult) {
+	if other.SnapshotID != "" {
+		if r.SnapshotID != "" {
+			r.SnapshotID += ","
+		}
+		r.SnapshotID += other.SnapshotID
+	}
+	r.FilesNew += other.FilesNew
+	r.FilesChanged += other.FilesChanged
+	r.FilesUnmodified += other.FilesUnmodified
+	r.FilesProcessed += other.FilesProcessed
+	r.DataAdded += other.DataAdded
+	r.Duration += other.Duration
+}
+
+// Run f, and return a result with its duration.
+// For providers whose backup program doesn't report anything else.
+func timed(f func() error) (*BackupResult, error) {
+	start := time.Now()
+	err := f()
+	if err != nil {
+		return nil, err
+	}
+	return &BackupResult{Duration: time.Since(start)}, nil
+}
+
+type Retention struct {
+	KeepLast    int
+	KeepHourly  int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+	KeepTag     []string
+	KeepWithin  string
+
+	GroupBy string
+	// Paths of the backup. Providers whose retention policy is set per source
+	// (kopia) apply it only to these paths.
+	Paths []string
+}
+
+type Snapshot struct {
+	ID       string    `json:"id"`
+	ShortID  string    `json:"short_id"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Username string    `json:"username"`
+	Tags     []string  `json:"tags"`
+	Paths    []string  `json:"paths"`
+}
+
+// Convert read_data_subset (either `n%` or `n/m`) to a percentage.
+// For providers that can't check a specific subset of the data.
+func readDataPercent(subset string) (float64, error) {
+	if percent, ok := strings.CutSuffix(subset, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid read_data_subset: %s", subset)
+		}
+		return p, nil
+	}
+	_, m, ok := strings.Cut(subset, "/")
+	if ok {
+		d, err := strconv.ParseFloat(m, 64)
+		if err == nil && d >= 1 {
+			return 100 / d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid read_data_subset: %s. it must be in the form of `n%%` or `n/m`", subset)
+}
@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDataPercent(t *testing.T) {
+	valid := map[string]float64{
+		"5%":    5,
+		"12.5%": 12.5,
+		"100%":  100,
+		"1/10":  10,
+		"3/4":   25,
+	}
+	for subset, expected := range valid {
+		percent, err := readDataPercent(subset)
+		require.NoError(t, err)
+		require.Equal(t, expected, percent)
+	}
+
+	for _, subset := range []string{"", "0%", "101%", "x%", "1/0", "5"} {
+		_, err := readDataPercent(subset)
+		require.Error(t, err, subset)
+	}
+}
+
+func TestBackupResultAdd(t *testing.T) {
+	r := &BackupResult{}
+	r.Add(&BackupResult{SnapshotID: "4bbaf3c1", FilesNew: 1, DataAdded: 10, Duration: time.Second})
+	r.Add(&BackupResult{SnapshotID: "5ccb04d2", FilesNew: 2, DataAdded: 20, Duration: time.Second})
+	require.Equal(t, "4bbaf3c1,5ccb04d2", r.SnapshotID)
+	require.Equal(t, uint64(3), r.FilesNew)
+	require.Equal(t, uint64(30), r.DataAdded)
+	require.Equal(t, 2*time.Second, r.Duration)
+}
@@ -1,13 +1,16 @@
 package provider
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"time"
 
-	"github.com/mattn/go-shellwords"
 	"go.uber.org/zap"
 )
 
@@ -20,6 +23,10 @@ type Restic struct {
 	extraArgs string
 	sudo      bool
 	password  string
+	// Tag of the snapshots of the backup. See SetBackupName.
+	tag string
+
+	progress func(p *Progress)
 }
 
 func NewRestic(
@@ -41,61 +48,291 @@ func NewRestic(
 
 func (r *Restic) TargetPath() string { return r.repoPath }
 
+// SetBackupName tags the snapshots that are created with the name of the backup. Only the
+// snapshots with the tag are listed and forgotten, so that backups sharing a repository
+// don't forget each other's snapshots.
+func (r *Restic) SetBackupName(name string) { r.tag = "kopyaship:" + name }
+
+func (r *Restic) tagFilter() string {
+	if r.tag == "" {
+		return ""
+	}
+	return fmt.Sprintf(" --tag '%s'", r.tag)
+}
+
 func (r *Restic) Init() error {
 	return r.run(fmt.Sprintf("restic -r '%s' init", r.repoPath))
 }
 
-func (r *Restic) Backup(path string) error {
-	path = filepath.ToSlash(path)
-	command := fmt.Sprintf("restic -r '%s' backup", r.repoPath)
+func (r *Restic) SetProgress(f func(p *Progress)) { r.progress = f }
+
+func (r *Restic) Backup(path string) (*BackupResult, error) {
+	return r.backup(r.backupCommand(false) + " " + filepath.ToSlash(path))
+}
+
+func (r *Restic) BackupWithIfile(ifile string) (*BackupResult, error) {
+	return r.backup(r.backupCommand(false) + " --files-from " + filepath.ToSlash(ifile))
+}
+
+func (r *Restic) DryRun(path string) (*BackupResult, error) {
+	return r.backup(r.backupCommand(true) + " " + filepath.ToSlash(path))
+}
+
+func (r *Restic) DryRunWithIfile(ifile string) (*BackupResult, error) {
+	return r.backup(r.backupCommand(true) + " --files-from " + filepath.ToSlash(ifile))
+}
+
+func (r *Restic) backupCommand(dryRun bool) string {
+	command := fmt.Sprintf("restic -r '%s' backup --json", r.repoPath)
+	if dryRun {
+		command += " --dry-run"
+	}
+	command += r.tagFilter()
 	if r.extraArgs != "" {
 		command += " " + r.extraArgs
 	}
-	command += " " + path
-	return r.run(command)
+	return command
 }
 
-func (r *Restic) BackupWithIfile(ifile string) error {
-	ifile = filepath.ToSlash(ifile)
-	command := fmt.Sprintf("restic -r '%s' backup", r.repoPath)
-	if r.extraArgs != "" {
-		command += " " + r.extraArgs
+// Run restic backup with --json, and decode its output while it runs.
+func (r *Restic) backup(command string) (result *BackupResult, err error) {
+	pr, pw := io.Pipe()
+	var (
+		parseErr error
+		parsed   = make(chan struct{})
+	)
+	go func() {
+		defer close(parsed)
+		result, parseErr = parseResticBackup(pr, r.progress, r.logS)
+		// Don't block restic if parsing has failed.
+		io.Copy(io.Discard, pr)
+	}()
+
+	err = r.runWithOutput(command, pw)
+	pw.Close()
+	<-parsed
+	if err != nil {
+		return nil, err
+	} else if parseErr != nil {
+		return nil, parseErr
+	}
+
+	if result.SnapshotID == "" {
+		// Dry run
+		r.logS.Infof(
+			"restic: dry run. files: %d new, %d changed, %d unmodified. would be added to the repository: %d bytes",
+			result.FilesNew, result.FilesChanged, result.FilesUnmodified, result.DataAdded,
+		)
+		return result, nil
 	}
-	return r.run(fmt.Sprintf("%s --files-from %s", command, ifile))
+	r.logS.Infof(
+		"restic: snapshot %s saved. files: %d new, %d changed, %d unmodified. added to the repository: %d bytes. took %s",
+		result.SnapshotID, result.FilesNew, result.FilesChanged, result.FilesUnmodified, result.DataAdded, result.Duration,
+	)
+	return result, nil
 }
 
-func (r *Restic) PasswordIsSet() bool {
-	return r.password != "" || os.Getenv("RESTIC_PASSWORD") != ""
+type resticBackupMessage struct {
+	MessageType string `json:"message_type"`
+
+	// status
+	PercentDone      float64 `json:"percent_done"`
+	SecondsRemaining uint64  `json:"seconds_remaining"`
+	TotalFiles       uint64  `json:"total_files"`
+	FilesDone        uint64  `json:"files_done"`
+	TotalBytes       uint64  `json:"total_bytes"`
+	BytesDone        uint64  `json:"bytes_done"`
+
+	// summary
+	FilesNew            uint64  `json:"files_new"`
+	FilesChanged        uint64  `json:"files_changed"`
+	FilesUnmodified     uint64  `json:"files_unmodified"`
+	DataAdded           uint64  `json:"data_added"`
+	TotalFilesProcessed uint64  `json:"total_files_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+	SnapshotID          string  `json:"snapshot_id"`
+
+	// error
+	Error  json.RawMessage `json:"error"`
+	During string          `json:"during"`
+	Item   string          `json:"item"`
 }
 
-func (r *Restic) run(command string) error {
-	parser := shellwords.NewParser()
-	parser.ParseBacktick = true
-	parser.ParseEnv = true
+// Decode the messages printed by `restic backup --json`. Status messages are
+// passed to progress, errors are logged, and the summary is returned.
+func parseResticBackup(r io.Reader, progress func(p *Progress), logS *zap.SugaredLogger) (*BackupResult, error) {
+	var result *BackupResult
+	scanner := bufio.NewScanner(r)
+	// Status messages contain the files being processed, and they can be long.
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		m := &resticBackupMessage{}
+		err := json.Unmarshal(line, m)
+		if err != nil {
+			// Not every line is guaranteed to be JSON (e.g. warnings of older versions).
+			logS.Info(string(line))
+			continue
+		}
 
-	if r.sudo {
-		command = "sudo " + command
+		switch m.MessageType {
+		case "status":
+			if progress != nil {
+				progress(&Progress{
+					PercentDone:      m.PercentDone,
+					FilesDone:        m.FilesDone,
+					TotalFiles:       m.TotalFiles,
+					BytesDone:        m.BytesDone,
+					TotalBytes:       m.TotalBytes,
+					SecondsRemaining: m.SecondsRemaining,
+				})
+			}
+		case "summary":
+			result = &BackupResult{
+				SnapshotID:      m.SnapshotID,
+				FilesNew:        m.FilesNew,
+				FilesChanged:    m.FilesChanged,
+				FilesUnmodified: m.FilesUnmodified,
+				FilesProcessed:  m.TotalFilesProcessed,
+				DataAdded:       m.DataAdded,
+				Duration:        time.Duration(m.TotalDuration * float64(time.Second)),
+			}
+		case "error":
+			// Error is an object with a message in newer versions, and a string in older ones.
+			var e struct {
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(m.Error, &e) != nil {
+				json.Unmarshal(m.Error, &e.Message)
+			}
+			logS.Warnf("restic: error during %s of %s: %s", m.During, m.Item, e.Message)
+		}
 	}
-	r.logS.Infof("Running: %s", command)
-	if r.password != "" {
-		err := os.Setenv("RESTIC_PASSWORD", r.password)
-		if err != nil {
-			return err
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	} else if result == nil {
+		return nil, fmt.Errorf("restic: no summary is printed by restic backup")
+	}
+	return result, nil
+}
+
+func (r *Restic) Forget(retention *Retention) error { return r.run(r.forgetCommand(retention)) }
+
+func (r *Restic) forgetCommand(retention *Retention) string {
+	command := fmt.Sprintf("restic -r '%s' forget", r.repoPath) + r.tagFilter()
+	keep := func(flag string, n int) {
+		if n > 0 {
+			command += fmt.Sprintf(" --%s %d", flag, n)
 		}
-		defer os.Unsetenv("RESTIC_PASSWORD")
 	}
+	keep("keep-last", retention.KeepLast)
+	keep("keep-hourly", retention.KeepHourly)
+	keep("keep-daily", retention.KeepDaily)
+	keep("keep-weekly", retention.KeepWeekly)
+	keep("keep-monthly", retention.KeepMonthly)
+	keep("keep-yearly", retention.KeepYearly)
+	for _, tag := range retention.KeepTag {
+		command += fmt.Sprintf(" --keep-tag '%s'", tag)
+	}
+	if retention.KeepWithin != "" {
+		command += fmt.Sprintf(" --keep-within '%s'", retention.KeepWithin)
+	}
+	if retention.GroupBy != "" {
+		command += fmt.Sprintf(" --group-by '%s'", retention.GroupBy)
+	}
+	return command
+}
+
+func (r *Restic) Prune() error {
+	return r.run(fmt.Sprintf("restic -r '%s' prune", r.repoPath))
+}
 
-	w, err := parser.Parse(command)
+func (r *Restic) Snapshots() ([]*Snapshot, error) {
+	stdout := bytes.Buffer{}
+	err := r.runWithOutput(fmt.Sprintf("restic -r '%s' snapshots --json", r.repoPath)+r.tagFilter(), &stdout)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(w) == 0 {
-		return fmt.Errorf("empty command")
+	return parseResticSnapshots(&stdout)
+}
+
+func parseResticSnapshots(r io.Reader) (snapshots []*Snapshot, err error) {
+	err = json.NewDecoder(r).Decode(&snapshots)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse restic snapshots: %v", err)
 	}
+	return
+}
 
-	cmd := exec.CommandContext(r.ctx, w[0], w[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+func (r *Restic) Restore(snapshotID, target string, include []string) error {
+	return r.run(r.restoreCommand(snapshotID, target, include))
+}
+
+// Extra arguments are not used, as they are for backups (e.g. --exclude-caches), and restore
+// doesn't accept some of them.
+func (r *Restic) restoreCommand(snapshotID, target string, include []string) string {
+	target = filepath.ToSlash(target)
+	command := fmt.Sprintf("restic -r '%s' restore '%s' --target '%s'", r.repoPath, snapshotID, target)
+	for _, pattern := range include {
+		command += fmt.Sprintf(" --include '%s'", pattern)
+	}
+	return command
+}
+
+func (r *Restic) Check(readDataSubset string) error {
+	command := fmt.Sprintf("restic -r '%s' check", r.repoPath)
+	if readDataSubset != "" {
+		command += fmt.Sprintf(" --read-data-subset '%s'", readDataSubset)
+	}
+	return r.run(command)
+}
+
+// Copy copies the snapshots in the repository `from` into this repository,
+// without reading the backed up data again. If host or tags are given,
+// only the matching snapshots are copied.
+func (r *Restic) Copy(from *Restic, host string, tags []string, extraArgs string) error {
+	c := &command{
+		command: r.copyCommand(from, host, tags, extraArgs),
+		sudo:    r.sudo,
+	}
+	if r.password != "" {
+		c.env = append(c.env, "RESTIC_PASSWORD="+r.password)
+	}
+	if from.password != "" {
+		c.env = append(c.env, "RESTIC_FROM_PASSWORD="+from.password)
+	}
+	return c.run(r.ctx, r.logS)
+}
+
+func (r *Restic) copyCommand(from *Restic, host string, tags []string, extraArgs string) string {
+	command := fmt.Sprintf("restic -r '%s' copy --from-repo '%s'", r.repoPath, from.repoPath)
+	if host != "" {
+		command += fmt.Sprintf(" --host '%s'", host)
+	}
+	for _, tag := range tags {
+		command += fmt.Sprintf(" --tag '%s'", tag)
+	}
+	if extraArgs != "" {
+		command += " " + extraArgs
+	}
+	return command
+}
+
+func (r *Restic) PasswordIsSet() bool {
+	return r.password != "" || os.Getenv("RESTIC_PASSWORD") != ""
+}
+
+func (r *Restic) run(cmd string) error { return r.runWithOutput(cmd, os.Stdout) }
+
+func (r *Restic) runWithOutput(cmd string, stdout io.Writer) error {
+	c := &command{
+		command: cmd,
+		sudo:    r.sudo,
+		stdout:  stdout,
+	}
+	if r.password != "" {
+		c.env = append(c.env, "RESTIC_PASSWORD="+r.password)
+	}
+	return c.run(r.ctx, r.logS)
 }
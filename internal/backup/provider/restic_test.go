@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseResticSnapshots(t *testing.T) {
+	const output = `[{"time":"2024-03-02T10:04:05.123456789+03:00","tree":"0d9a4e8b","paths":["/home/glenda/Desktop","/home/glenda/Documents"],"hostname":"StevesComputer","username":"glenda","uid":1000,"gid":1000,"tags":["daily"],"id":"4bbaf3c1a1d5d2f1d4c5b2e9a8f7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9","short_id":"4bbaf3c1"},{"time":"2024-03-03T10:04:05+03:00","tree":"1e0b5f9c","paths":["/home/glenda/.ssh"],"hostname":"StevesComputer","username":"glenda","id":"5ccb04d2b2e6e3a2e5d6c3fab908d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0","short_id":"5ccb04d2"}]`
+
+	snapshots, err := parseResticSnapshots(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+
+	s := snapshots[0]
+	require.Equal(t, "4bbaf3c1", s.ShortID)
+	require.Equal(t, "StevesComputer", s.Hostname)
+	require.Equal(t, "glenda", s.Username)
+	require.Equal(t, []string{"daily"}, s.Tags)
+	require.Equal(t, []string{"/home/glenda/Desktop", "/home/glenda/Documents"}, s.Paths)
+	require.True(t, s.Time.Equal(time.Date(2024, 3, 2, 7, 4, 5, 123456789, time.UTC)))
+
+	require.Empty(t, snapshots[1].Tags)
+	require.Equal(t, []string{"/home/glenda/.ssh"}, snapshots[1].Paths)
+
+	_, err = parseResticSnapshots(strings.NewReader("Fatal: wrong password or no key found"))
+	require.Error(t, err)
+}
+
+func TestResticCopyCommand(t *testing.T) {
+	from := NewRestic(context.Background(), "/var/backup/primary", "", "", false, zap.NewNop())
+	to := NewRestic(context.Background(), "/mnt/offsite", "-H StevesComputer", "", false, zap.NewNop())
+
+	require.Equal(t,
+		"restic -r '/mnt/offsite' copy --from-repo '/var/backup/primary'",
+		to.copyCommand(from, "", nil, ""),
+	)
+	// Extra arguments of the repository are for backups, and are not used.
+	require.Equal(t,
+		"restic -r '/mnt/offsite' copy --from-repo '/var/backup/primary' --host 'StevesComputer' --tag 'daily' --tag 'home' --verbose",
+		to.copyCommand(from, "StevesComputer", []string{"daily", "home"}, "--verbose"),
+	)
+}
+
+func TestResticBackupCommand(t *testing.T) {
+	r := NewRestic(context.Background(), "/var/backup/primary", "-H StevesComputer", "", false, zap.NewNop())
+	require.Equal(t, "restic -r '/var/backup/primary' backup --json -H StevesComputer", r.backupCommand(false))
+	require.Equal(t, "restic -r '/var/backup/primary' backup --json --dry-run -H StevesComputer", r.backupCommand(true))
+
+	r.SetBackupName("home")
+	require.Equal(t, "restic -r '/var/backup/primary' backup --json --tag 'kopyaship:home' -H StevesComputer", r.backupCommand(false))
+}
+
+func TestResticRestoreCommand(t *testing.T) {
+	r := NewRestic(context.Background(), "/var/backup/primary", "--exclude-caches --one-file-system", "", false, zap.NewNop())
+	require.Equal(t,
+		"restic -r '/var/backup/primary' restore '4bbaf3c1' --target '/tmp/restore' --include '*.txt'",
+		r.restoreCommand("4bbaf3c1", "/tmp/restore", []string{"*.txt"}),
+	)
+}
+
+func TestResticForgetCommand(t *testing.T) {
+	r := NewRestic(context.Background(), "/var/backup/primary", "", "", false, zap.NewNop())
+	r.SetBackupName("home")
+	require.Equal(t,
+		"restic -r '/var/backup/primary' forget --tag 'kopyaship:home' --keep-last 3 --group-by 'host,tags'",
+		r.forgetCommand(&Retention{KeepLast: 3, GroupBy: "host,tags"}),
+	)
+}
+
+func TestParseResticBackup(t *testing.T) {
+	const output = `{"message_type":"status","percent_done":0,"total_files":1,"total_bytes":10}
+{"message_type":"status","seconds_elapsed":1,"seconds_remaining":2,"percent_done":0.5,"total_files":3,"files_done":1,"total_bytes":2048,"bytes_done":1024,"current_files":["/home/glenda/Documents/a"]}
+{"message_type":"error","error":{"message":"open /home/glenda/Documents/secret: permission denied"},"during":"archival","item":"/home/glenda/Documents/secret"}
+using parent snapshot 4bbaf3c1
+{"message_type":"summary","files_new":2,"files_changed":1,"files_unmodified":5,"dirs_new":0,"dirs_changed":1,"dirs_unmodified":2,"data_blobs":3,"tree_blobs":2,"data_added":4096,"total_files_processed":8,"total_bytes_processed":8192,"total_duration":1.5,"snapshot_id":"5ccb04d2b2e6e3a2e5d6c3fab908d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0"}
+`
+	var progress []*Progress
+	result, err := parseResticBackup(strings.NewReader(output), func(p *Progress) { progress = append(progress, p) }, zap.NewNop().Sugar())
+	require.NoError(t, err)
+
+	require.Len(t, progress, 2)
+	require.Equal(t, 0.5, progress[1].PercentDone)
+	require.Equal(t, uint64(1024), progress[1].BytesDone)
+	require.Equal(t, uint64(3), progress[1].TotalFiles)
+	require.Equal(t, uint64(2), progress[1].SecondsRemaining)
+
+	require.Equal(t, &BackupResult{
+		SnapshotID:      "5ccb04d2b2e6e3a2e5d6c3fab908d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0",
+		FilesNew:        2,
+		FilesChanged:    1,
+		FilesUnmodified: 5,
+		FilesProcessed:  8,
+		DataAdded:       4096,
+		Duration:        1500 * time.Millisecond,
+	}, result)
+
+	// Restic failed before printing a summary.
+	_, err = parseResticBackup(strings.NewReader(`{"message_type":"status","percent_done":0}`), nil, zap.NewNop().Sugar())
+	require.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Apply the retention policy to snapshots, the way restic does. Used by
+// providers that don't have a retention policy of their own. Snapshots
+// are grouped together; GroupBy and KeepTag are not taken into account.
+func (r *Retention) apply(snapshots []*Snapshot) (keep, remove []*Snapshot, err error) {
+	sorted := make([]*Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	// Newest first
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+
+	var within time.Time
+	if r.KeepWithin != "" && len(sorted) > 0 {
+		within, err = subtractDuration(sorted[0].Time, r.KeepWithin)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	buckets := []struct {
+		count int
+		key   func(t time.Time) string
+		last  string
+	}{
+		{count: r.KeepLast, key: func(t time.Time) string { return t.Format(time.RFC3339Nano) }},
+		{count: r.KeepHourly, key: func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{count: r.KeepDaily, key: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{count: r.KeepWeekly, key: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{count: r.KeepMonthly, key: func(t time.Time) string { return t.Format("2006-01") }},
+		{count: r.KeepYearly, key: func(t time.Time) string { return t.Format("2006") }},
+	}
+
+	for i, s := range sorted {
+		kept := !within.IsZero() && !s.Time.Before(within)
+		for j := range buckets {
+			b := &buckets[j]
+			if b.count <= 0 {
+				continue
+			}
+			// keep-last keeps every snapshot, even if two of them have the same time.
+			key := b.key(s.Time)
+			if j == 0 {
+				key = strconv.Itoa(i)
+			}
+			if key != b.last {
+				b.last = key
+				b.count--
+				kept = true
+			}
+		}
+		if kept {
+			keep = append(keep, s)
+		} else {
+			remove = append(remove, s)
+		}
+	}
+	return
+}
+
+var durationRe = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)m)?(?:(\d+)d)?(?:(\d+)h)?$`)
+
+// Subtract a restic style duration (e.g. 1y5m7d2h) from t.
+func subtractDuration(t time.Time, duration string) (time.Time, error) {
+	m := durationRe.FindStringSubmatch(duration)
+	if m == nil || duration == "" {
+		return time.Time{}, fmt.Errorf("invalid duration: %s. it must be in the form of 1y5m7d2h", duration)
+	}
+	n := make([]int, 4)
+	for i := range n {
+		if m[i+1] != "" {
+			n[i], _ = strconv.Atoi(m[i+1])
+		}
+	}
+	return t.AddDate(-n[0], -n[1], -n[2]).Add(-time.Duration(n[3]) * time.Hour), nil
+}
@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionApply(t *testing.T) {
+	var (
+		snapshots []*Snapshot
+		start     = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	)
+	// 2 snapshots per day for 60 days
+	for i := 0; i < 120; i++ {
+		snapshots = append(snapshots, &Snapshot{
+			ID:   start.Add(time.Duration(i) * 12 * time.Hour).Format(time.RFC3339),
+			Time: start.Add(time.Duration(i) * 12 * time.Hour),
+		})
+	}
+	ids := func(snapshots []*Snapshot) (ids []string) {
+		for _, s := range snapshots {
+			ids = append(ids, s.ID)
+		}
+		return
+	}
+
+	keep, remove, err := (&Retention{KeepLast: 3}).apply(snapshots)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2024-03-01T00:00:00Z", "2024-02-29T12:00:00Z", "2024-02-29T00:00:00Z"}, ids(keep))
+	require.Len(t, remove, 117)
+
+	keep, _, err = (&Retention{KeepDaily: 2, KeepMonthly: 3}).apply(snapshots)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2024-03-01T00:00:00Z", "2024-02-29T12:00:00Z", "2024-01-31T12:00:00Z"}, ids(keep))
+
+	keep, _, err = (&Retention{KeepWithin: "1d"}).apply(snapshots)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2024-03-01T00:00:00Z", "2024-02-29T12:00:00Z", "2024-02-29T00:00:00Z"}, ids(keep))
+
+	_, _, err = (&Retention{KeepWithin: "1w"}).apply(snapshots)
+	require.Error(t, err)
+}
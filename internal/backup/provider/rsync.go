@@ -0,0 +1,335 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Layout of the dated directories created when link-dest is enabled.
+const rsyncSnapshotLayout = "2006-01-02T15-04-05"
+
+// ID of the only snapshot when link-dest is disabled.
+const rsyncMirrorID = "mirror"
+
+type Rsync struct {
+	ctx  context.Context
+	log  *zap.Logger
+	logS *zap.SugaredLogger
+
+	dest      string
+	extraArgs string
+	sudo      bool
+	delete    bool
+	linkDest  bool
+
+	// Configured paths of the backup. Only their subtrees in the
+	// destination are pruned, as it might contain other data.
+	paths []string
+
+	// All paths of a backup are put into the same dated directory,
+	// which is named after the first backup done by this provider.
+	snapshot     string
+	snapshotOnce sync.Once
+}
+
+func NewRsync(
+	ctx context.Context,
+	dest, extraArgs string,
+	sudo, delete, linkDest bool,
+	log *zap.Logger,
+) *Rsync {
+	return &Rsync{
+		ctx:       ctx,
+		log:       log,
+		logS:      log.Sugar(),
+		dest:      filepath.ToSlash(dest),
+		extraArgs: extraArgs,
+		sudo:      sudo,
+		delete:    delete,
+		linkDest:  linkDest,
+	}
+}
+
+func (r *Rsync) TargetPath() string { return r.dest }
+
+// SetPaths sets the configured paths of the backup, which limit
+// the files that are removed from the mirror in ifile mode.
+func (r *Rsync) SetPaths(paths []string) { r.paths = paths }
+
+func (r *Rsync) Init() error {
+	if r.sudo {
+		return r.run(fmt.Sprintf("mkdir -p '%s'", r.dest))
+	}
+	return os.MkdirAll(r.dest, 0755)
+}
+
+// Returns the rsync command that copies into the destination directory
+// of the current backup. rsync refuses --delete without recursion, so it
+// is only added if delete is true.
+func (r *Rsync) command(delete bool) (command, dest string, err error) {
+	command = "rsync -a --relative"
+	if delete {
+		command += " --delete"
+	}
+	if r.extraArgs != "" {
+		command += " " + r.extraArgs
+	}
+	if !r.linkDest {
+		return command, r.dest, nil
+	}
+
+	r.snapshotOnce.Do(func() { r.snapshot = time.Now().Format(rsyncSnapshotLayout) })
+	snapshots, err := r.Snapshots()
+	if err != nil {
+		return "", "", err
+	}
+	// Snapshots are sorted from oldest to newest.
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].ID != r.snapshot {
+			// Relative paths are resolved against the destination, so use an absolute path.
+			prev, err := filepath.Abs(filepath.Join(r.dest, snapshots[i].ID))
+			if err != nil {
+				return "", "", err
+			}
+			command += fmt.Sprintf(" --link-dest '%s'", filepath.ToSlash(prev))
+			break
+		}
+	}
+	return command, r.dest + "/" + r.snapshot, nil
+}
+
+func (r *Rsync) Backup(path string) (*BackupResult, error) {
+	return r.result(func() error { return r.backup(path) })
+}
+
+func (r *Rsync) BackupWithIfile(ifile string) (*BackupResult, error) {
+	return r.result(func() error { return r.backupWithIfile(ifile) })
+}
+
+func (r *Rsync) result(backup func() error) (*BackupResult, error) {
+	result, err := timed(backup)
+	if err != nil {
+		return nil, err
+	}
+	result.SnapshotID = rsyncMirrorID
+	if r.linkDest {
+		result.SnapshotID = r.snapshot
+	}
+	return result, nil
+}
+
+func (r *Rsync) backup(path string) error {
+	command, dest, err := r.command(r.delete)
+	if err != nil {
+		return err
+	}
+	return r.run(fmt.Sprintf("%s '%s' '%s/'", command, filepath.ToSlash(path), dest))
+}
+
+func (r *Rsync) backupWithIfile(ifile string) error {
+	paths, err := ReadIncludeList(ifile)
+	if err != nil {
+		return err
+	}
+
+	// Paths in --files-from are relative to the source directory, which is the root.
+	filesFrom, err := os.CreateTemp("", "kopyaship_rsync_*.list")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filesFrom.Name())
+	for _, path := range paths {
+		_, err = filesFrom.WriteString(strings.TrimPrefix(path, "/") + "\n")
+		if err != nil {
+			filesFrom.Close()
+			return err
+		}
+	}
+	err = filesFrom.Close()
+	if err != nil {
+		return err
+	}
+
+	command, dest, err := r.command(false)
+	if err != nil {
+		return err
+	}
+	err = r.run(fmt.Sprintf("%s --files-from '%s' / '%s/'", command, filepath.ToSlash(filesFrom.Name()), dest))
+	if err != nil {
+		return err
+	}
+
+	// rsync doesn't delete anything when --files-from is used.
+	// Remove the files that are no longer in the ifile by ourselves.
+	if r.delete && !r.linkDest {
+		return pruneMirror(dest, r.paths, paths, r.remove)
+	}
+	return nil
+}
+
+// Remove the files and directories under the roots in dest that are not
+// in paths, and not parent directories of any path in paths. Anything
+// outside of the roots is left untouched.
+func pruneMirror(dest string, roots, paths []string, remove func(path string) error) error {
+	keep := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		path = strings.Trim(filepath.ToSlash(path), "/")
+		for path != "." && path != "" {
+			if _, ok := keep[path]; ok {
+				break
+			}
+			keep[path] = struct{}{}
+			path = filepath.ToSlash(filepath.Dir(path))
+		}
+	}
+
+	var toRemove []string
+	for _, root := range roots {
+		root = filepath.Join(dest, strings.Trim(filepath.ToSlash(root), "/"))
+		_, err := os.Lstat(root)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			} else if path == root {
+				return nil
+			}
+			rel, err := filepath.Rel(dest, path)
+			if err != nil {
+				return err
+			}
+			if _, ok := keep[filepath.ToSlash(rel)]; !ok {
+				toRemove = append(toRemove, path)
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range toRemove {
+		err := remove(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rsync) remove(path string) error {
+	if r.sudo {
+		return r.run(fmt.Sprintf("rm -rf '%s'", filepath.ToSlash(path)))
+	}
+	return os.RemoveAll(path)
+}
+
+func (r *Rsync) Forget(retention *Retention) error {
+	if !r.linkDest {
+		return fmt.Errorf("rsync: retention policies require `link_dest` to be enabled")
+	} else if len(retention.KeepTag) > 0 {
+		return fmt.Errorf("rsync: keep_tag is not supported")
+	}
+	snapshots, err := r.Snapshots()
+	if err != nil {
+		return err
+	}
+	_, remove, err := retention.apply(snapshots)
+	if err != nil {
+		return err
+	}
+	for _, s := range remove {
+		r.logS.Infof("Removing snapshot: %s", s.ID)
+		err = r.remove(filepath.Join(r.dest, s.ID))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removed snapshots don't leave anything behind. Nothing to prune.
+func (r *Rsync) Prune() error { return nil }
+
+// Snapshots returns the dated directories sorted from oldest to newest.
+// If link-dest is disabled, the destination itself is the only snapshot.
+func (r *Rsync) Snapshots() ([]*Snapshot, error) {
+	if !r.linkDest {
+		stat, err := os.Stat(r.dest)
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return []*Snapshot{{ID: rsyncMirrorID, ShortID: rsyncMirrorID, Time: stat.ModTime()}}, nil
+	}
+
+	entries, err := os.ReadDir(r.dest)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(rsyncSnapshotLayout, entry.Name(), time.Local)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, &Snapshot{ID: entry.Name(), ShortID: entry.Name(), Time: t})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+func (r *Rsync) Restore(snapshotID, target string, include []string) error {
+	src := r.dest
+	if r.linkDest {
+		src += "/" + snapshotID
+	} else if snapshotID != rsyncMirrorID {
+		return fmt.Errorf("rsync: no such snapshot: %s. the only snapshot is `%s`", snapshotID, rsyncMirrorID)
+	}
+
+	command := "rsync -a"
+	if len(include) > 0 {
+		command += " --prune-empty-dirs --include '*/'"
+		for _, pattern := range include {
+			command += fmt.Sprintf(" --include '%s'", pattern)
+		}
+		command += " --exclude '*'"
+	}
+	return r.run(fmt.Sprintf("%s '%s/' '%s/'", command, src, filepath.ToSlash(target)))
+}
+
+func (r *Rsync) Check(readDataSubset string) error {
+	return fmt.Errorf("rsync: checking is not supported")
+}
+
+// rsync doesn't use a password.
+func (r *Rsync) PasswordIsSet() bool { return true }
+
+func (r *Rsync) run(cmd string) error {
+	c := &command{
+		command: cmd,
+		sudo:    r.sudo,
+	}
+	return c.run(r.ctx, r.logS)
+}
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneMirror(t *testing.T) {
+	dest := t.TempDir()
+	create := func(path string) {
+		path = filepath.Join(dest, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+	create("home/glenda/Documents/a")
+	create("home/glenda/Documents/b")
+	create("home/glenda/Documents/old/c")
+	create("home/glenda/Desktop/d")
+	create("home/rob/e")
+	create("etc/f")
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "home/glenda/Documents/empty"), 0755))
+
+	var removed []string
+	remove := func(path string) error {
+		rel, err := filepath.Rel(dest, path)
+		require.NoError(t, err)
+		removed = append(removed, filepath.ToSlash(rel))
+		return os.RemoveAll(path)
+	}
+
+	err := pruneMirror(dest, []string{"/home/glenda", "/var/empty"}, []string{
+		"/home/glenda/Documents/a",
+		"/home/glenda/Documents/empty",
+	}, remove)
+	require.NoError(t, err)
+
+	sort.Strings(removed)
+	require.Equal(t, []string{
+		"home/glenda/Desktop",
+		"home/glenda/Documents/b",
+		"home/glenda/Documents/old",
+	}, removed)
+	require.FileExists(t, filepath.Join(dest, "home/glenda/Documents/a"))
+	require.DirExists(t, filepath.Join(dest, "home/glenda/Documents/empty"))
+	// Outside of the backup paths.
+	require.FileExists(t, filepath.Join(dest, "home/rob/e"))
+	require.FileExists(t, filepath.Join(dest, "etc/f"))
+}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+	"github.com/tomruk/kopyaship/internal/config"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+type (
+	Replications map[string]*Replication
+
+	Replication struct {
+		asService bool
+		log       *zap.Logger
+		Config    *config.ReplicationRun
+
+		Name string
+		From *provider.Restic
+		To   *provider.Restic
+	}
+)
+
+func ReplicationsFromConfig(
+	ctx context.Context,
+	configReplication *config.Replication,
+	log *zap.Logger,
+	asService bool,
+	include ...string,
+) (replications Replications, err error) {
+	replications = make(Replications)
+	for _, run := range configReplication.Run {
+		if run.From == nil || run.To == nil {
+			return nil, fmt.Errorf("both `from` and `to` must be set for replication `%s`", run.Name)
+		}
+		replications[run.Name] = &Replication{
+			asService: asService,
+			log:       log,
+			Config:    run,
+			Name:      run.Name,
+			From:      provider.NewRestic(ctx, run.From.Repo, run.From.ExtraArgs, run.From.Password, run.From.Sudo, log),
+			To:        provider.NewRestic(ctx, run.To.Repo, run.To.ExtraArgs, run.To.Password, run.To.Sudo, log),
+		}
+	}
+
+	if len(include) > 0 {
+		included := make(Replications)
+		for _, name := range include {
+			r, ok := replications[name]
+			if !ok {
+				return nil, fmt.Errorf("no replication with name: %s", name)
+			}
+			included[name] = r
+		}
+		replications = included
+	}
+	return
+}
+
+// Do copies the snapshots of the source repository into the destination repository.
+func (r *Replication) Do() error {
+	r.log.Sugar().Infof("Replicate: %s (%s -> %s)", r.Name, r.From.TargetPath(), r.To.TargetPath())
+	if !r.asService {
+		fmt.Println()
+		utils.BgBlue.Printf("Replicate: %s -> %s", r.From.TargetPath(), r.To.TargetPath())
+		fmt.Println()
+	}
+	return r.To.Copy(r.From, r.Config.Host, r.Config.Tags, r.Config.ExtraArgs)
+}
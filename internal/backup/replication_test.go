@@ -0,0 +1,25 @@
+package backup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/kopyaship/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestReplicationsFromConfig(t *testing.T) {
+	replications, err := ReplicationsFromConfig(context.Background(), &config.Replication{
+		Run: []*config.ReplicationRun{
+			{Name: "offsite", From: &config.Restic{Repo: "/tmp/restic"}, To: &config.Restic{Repo: "/mnt/nas/restic"}},
+		},
+	}, zap.NewNop(), true)
+	require.NoError(t, err)
+	require.Equal(t, "/mnt/nas/restic", replications["offsite"].To.TargetPath())
+
+	_, err = ReplicationsFromConfig(context.Background(), &config.Replication{
+		Run: []*config.ReplicationRun{{Name: "offsite", From: &config.Restic{Repo: "/tmp/restic"}}},
+	}, zap.NewNop(), true)
+	require.ErrorContains(t, err, "both `from` and `to` must be set")
+}
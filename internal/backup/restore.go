@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+// Restore restores the snapshot from the backup target with the name from (see Target) into target.
+// If snapshotID is empty or "latest", the latest snapshot that belongs to this backup is restored.
+// Unless force is true, restoring into a non-empty directory is refused.
+func (b *Backup) Restore(from, snapshotID, target string, include []string, force bool) error {
+	t, err := b.Target(from)
+	if err != nil {
+		return err
+	}
+	p := t.Provider
+	err = checkRestoreTarget(target, force)
+	if err != nil {
+		return err
+	}
+
+	if snapshotID == "" || snapshotID == "latest" {
+		snapshots, err := p.Snapshots()
+		if err != nil {
+			return err
+		}
+		latest := latestSnapshot(snapshots, b.Paths.Paths())
+		if latest == nil {
+			return fmt.Errorf("no snapshot found for backup `%s` in %s. specify a snapshot ID to restore", b.Name, p.TargetPath())
+		}
+		snapshotID = latest.ID
+	}
+
+	b.log.Sugar().Infof("Restore: %s: %s (%s) -> %s", b.Name, snapshotID, t.Name, target)
+	if !b.asService {
+		fmt.Println()
+		utils.BgBlue.Printf("Restore: %s (%s) -> %s", snapshotID, t.Name, target)
+		fmt.Println()
+	}
+	return p.Restore(snapshotID, target, include)
+}
+
+func checkRestoreTarget(target string, force bool) error {
+	stat, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if !stat.IsDir() {
+		return fmt.Errorf("restore target `%s` is not a directory", target)
+	} else if force {
+		return nil
+	}
+
+	dir, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	_, err = dir.Readdirnames(1)
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return fmt.Errorf("restore target `%s` is not empty. to restore anyway, use --force", target)
+}
+
+// latestSnapshot returns the latest snapshot that only contains the given
+// paths or their descendants. Snapshots of backups that use an ifile contain
+// the files listed in the ifile rather than the backup paths themselves.
+// Snapshots without paths (the provider doesn't report them) are assumed to
+// belong to the backup.
+func latestSnapshot(snapshots []*provider.Snapshot, paths []string) (latest *provider.Snapshot) {
+	within := func(path string) bool {
+		for _, p := range paths {
+			if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+outer:
+	for _, s := range snapshots {
+		for _, path := range s.Paths {
+			if !within(path) {
+				continue outer
+			}
+		}
+		if latest == nil || s.Time.After(latest.Time) {
+			latest = s
+		}
+	}
+	return
+}
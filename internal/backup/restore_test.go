@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+)
+
+func TestCheckRestoreTarget(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, checkRestoreTarget(filepath.Join(dir, "nonexistent"), false))
+	require.NoError(t, checkRestoreTarget(dir, false))
+
+	err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	require.NoError(t, err)
+	require.Error(t, checkRestoreTarget(dir, false))
+	require.NoError(t, checkRestoreTarget(dir, true))
+
+	// Restoring into a file is never allowed.
+	require.Error(t, checkRestoreTarget(filepath.Join(dir, "file"), true))
+}
+
+func TestLatestSnapshot(t *testing.T) {
+	now := time.Now()
+	snapshots := []*provider.Snapshot{
+		{ID: "1", Time: now.Add(-3 * time.Hour), Paths: []string{"/home/glenda/Desktop", "/home/glenda/Documents"}},
+		// ifile based
+		{ID: "2", Time: now.Add(-2 * time.Hour), Paths: []string{"/home/glenda/Desktop/a", "/home/glenda/Documents/b/c"}},
+		// Belongs to another backup
+		{ID: "3", Time: now.Add(-1 * time.Hour), Paths: []string{"/home/glenda/Desktop/a", "/var/lib/x"}},
+		{ID: "4", Time: now, Paths: []string{"/home/glenda/DesktopOther"}},
+	}
+
+	latest := latestSnapshot(snapshots, []string{"/home/glenda/Desktop", "/home/glenda/Documents"})
+	require.NotNil(t, latest)
+	require.Equal(t, "2", latest.ID)
+
+	latest = latestSnapshot(snapshots, []string{"/etc"})
+	require.Nil(t, latest)
+
+	// Without paths
+	snapshots = append(snapshots, &provider.Snapshot{ID: "5", Time: now.Add(time.Hour)})
+	latest = latestSnapshot(snapshots, []string{"/etc"})
+	require.NotNil(t, latest)
+	require.Equal(t, "5", latest.ID)
+}
@@ -0,0 +1,10 @@
+package config
+
+type Archive struct {
+	// Directory the archives are written into.
+	Dir string `mapstructure:"dir"`
+	// Either `tar.zst` or `tar.gz`. Defaults to `tar.zst`.
+	Format string `mapstructure:"format"`
+	// If set, archives are encrypted with this passphrase using age.
+	Password string `mapstructure:"password"`
+}
@@ -1,15 +1,32 @@
 package config
 
+import "time"
+
 type (
 	Backups struct {
 		Run []*BackupRun `mapstructure:"run"`
 	}
 
 	BackupRun struct {
-		Name   string  `mapstructure:"name"`
-		Restic *Restic `mapstructure:"restic"`
+		Name string `mapstructure:"name"`
+
+		Providers `mapstructure:",squash"`
+		// Additional repositories this backup is written to.
+		Targets []*Target `mapstructure:"targets"`
+		// Either `any` or `all`. If `any` (default), the backup fails if any of
+		// its targets fails. If `all`, it fails only if all of its targets fail.
+		FailOn string `mapstructure:"fail_on"`
 
 		UseIfile bool `mapstructure:"use_ifile"`
+		// Sources of ignore patterns that are read while generating the ifile.
+		Ignore Ignore `mapstructure:"ignore"`
+
+		// How often the service runs this backup. Either an interval (e.g. `6h`),
+		// or a cron expression (e.g. `0 3 * * *`). If empty, the backup isn't scheduled.
+		Schedule string `mapstructure:"schedule"`
+
+		Retention *Retention `mapstructure:"retention"`
+		Check     *Check     `mapstructure:"check"`
 
 		Hooks     Hooks     `mapstructure:"hooks"`
 		Reminders Reminders `mapstructure:"reminders"`
@@ -17,4 +34,85 @@ type (
 		Base  string   `mapstructure:"base"`
 		Paths []string `mapstructure:"paths"`
 	}
+
+	// Only one of the backup providers can be set.
+	Providers struct {
+		Restic  *Restic  `mapstructure:"restic"`
+		Borg    *Borg    `mapstructure:"borg"`
+		Kopia   *Kopia   `mapstructure:"kopia"`
+		Rsync   *Rsync   `mapstructure:"rsync"`
+		Archive *Archive `mapstructure:"archive"`
+	}
+
+	Target struct {
+		// Name of the target that is shown in logs. Defaults to the path of the repository.
+		Name string `mapstructure:"name"`
+
+		Providers `mapstructure:",squash"`
+	}
+
+	Retention struct {
+		KeepLast    int      `mapstructure:"keep_last"`
+		KeepHourly  int      `mapstructure:"keep_hourly"`
+		KeepDaily   int      `mapstructure:"keep_daily"`
+		KeepWeekly  int      `mapstructure:"keep_weekly"`
+		KeepMonthly int      `mapstructure:"keep_monthly"`
+		KeepYearly  int      `mapstructure:"keep_yearly"`
+		KeepTag     []string `mapstructure:"keep_tag"`
+		KeepWithin  string   `mapstructure:"keep_within"`
+
+		// How snapshots are grouped before the policy is applied.
+		// If empty, backup program's default is used.
+		GroupBy string `mapstructure:"group_by"`
+		// Remove the unreferenced data after forgetting snapshots.
+		Prune bool `mapstructure:"prune"`
+		// Apply the retention policy after every successful backup.
+		AfterBackup bool `mapstructure:"after_backup"`
+	}
+
+	Check struct {
+		// Portion of the data to read and verify (e.g. `5%` or `1/10`).
+		// If empty, only the structure of the repository is checked.
+		ReadDataSubset string `mapstructure:"read_data_subset"`
+		// Check the repository after every N successful backups. 0 disables it.
+		Every int `mapstructure:"every"`
+		// Warn if the repository is not verified for this long. 0 disables it.
+		WarnAfter time.Duration `mapstructure:"warn_after"`
+	}
+)
+
+const (
+	FailOnAny = "any"
+	FailOnAll = "all"
 )
+
+// Configured returns the names of the configured providers.
+func (p *Providers) Configured() (names []string) {
+	if p.Restic != nil {
+		names = append(names, "restic")
+	}
+	if p.Borg != nil {
+		names = append(names, "borg")
+	}
+	if p.Kopia != nil {
+		names = append(names, "kopia")
+	}
+	if p.Rsync != nil {
+		names = append(names, "rsync")
+	}
+	if p.Archive != nil {
+		names = append(names, "archive")
+	}
+	return
+}
+
+func (r *Retention) IsEmpty() bool {
+	return r.KeepLast == 0 &&
+		r.KeepHourly == 0 &&
+		r.KeepDaily == 0 &&
+		r.KeepWeekly == 0 &&
+		r.KeepMonthly == 0 &&
+		r.KeepYearly == 0 &&
+		len(r.KeepTag) == 0 &&
+		r.KeepWithin == ""
+}
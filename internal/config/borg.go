@@ -0,0 +1,21 @@
+package config
+
+type Borg struct {
+	Repo      string `mapstructure:"repo"`
+	Sudo      bool   `mapstructure:"sudo"`
+	ExtraArgs string `mapstructure:"extra_args"`
+	Password  string `mapstructure:"password"`
+	// Encryption mode used while initializing the repository. Defaults to `repokey`.
+	Encryption string `mapstructure:"encryption"`
+	// Prefix of archive names. Defaults to `<backup name>-{hostname}-`.
+	ArchivePrefix string `mapstructure:"archive_prefix"`
+}
+
+// Prefix returns the prefix of the archive names of the backup. Archives are listed and pruned by
+// their prefix, so every backup in a repository needs its own.
+func (b *Borg) Prefix(backup string) string {
+	if b.ArchivePrefix != "" {
+		return b.ArchivePrefix
+	}
+	return backup + "-{hostname}-"
+}
@@ -10,11 +10,14 @@ import (
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
+	"github.com/tomruk/kopyaship/internal/schedule"
 )
 
 type (
 	Config struct {
 		Backups         Backups           `mapstructure:"backups"`
+		Replication     Replication       `mapstructure:"replication"`
+		Notifications   Notifications     `mapstructure:"notifications"`
 		IfileGeneration IfileGeneration   `mapstructure:"ifile_generation"`
 		Env             map[string]string `mapstructure:"env"`
 		Service         Service           `mapstructure:"service"`
@@ -25,14 +28,38 @@ type (
 	}
 
 	IfileGenerationRun struct {
-		Ifile string `mapstructure:"ifile"`
-		Type  string `mapstructure:"type"`
-		Hooks Hooks  `mapstructure:"hooks"`
+		Ifile  string `mapstructure:"ifile"`
+		Type   string `mapstructure:"type"`
+		Ignore Ignore `mapstructure:"ignore"`
+		Hooks  Hooks  `mapstructure:"hooks"`
+	}
+
+	// Sources of ignore patterns.
+	Ignore struct {
+		// Names of the ignore files that are read in every directory. Later ones
+		// take precedence over earlier ones. Defaults to `.gitignore` and `.ksignore`.
+		Files []string `mapstructure:"files"`
+		// Patterns in gitignore format that apply at the root of each path.
+		Exclude []string `mapstructure:"exclude"`
+		// Patterns that include paths excluded by other patterns. They are
+		// written without the leading `!`, and take precedence over exclude.
+		Include []string `mapstructure:"include"`
+
+		// Below are read in directories that contain a git repository.
+
+		// Read `.git/info/exclude`. Defaults to true.
+		GitInfoExclude *bool `mapstructure:"git_info_exclude"`
+		// Read the global excludes file of git (`core.excludesFile`). Defaults to true.
+		GitGlobalExcludes *bool `mapstructure:"git_global_excludes"`
 	}
 
 	Hooks struct {
 		Pre  []string `mapstructure:"pre"`
 		Post []string `mapstructure:"post"`
+		// Only supported by backups.
+		OnError []string `mapstructure:"on_error"`
+		// Only supported by backups.
+		Finally []string `mapstructure:"finally"`
 	}
 
 	Reminders struct {
@@ -157,19 +184,126 @@ func (c *Config) PlaceEnvironmentVariables() error {
 	}
 
 	for i := range c.Backups.Run {
-		replace(&c.Backups.Run[i].Restic.Repo)
-		replace(&c.Backups.Run[i].Restic.ExtraArgs)
+		replaceProviders(&c.Backups.Run[i].Providers, replace)
+		for _, target := range c.Backups.Run[i].Targets {
+			replaceProviders(&target.Providers, replace)
+		}
 		for j := range c.Backups.Run[i].Hooks.Pre {
 			replace(&c.Backups.Run[i].Hooks.Pre[j])
 		}
 		for j := range c.Backups.Run[i].Hooks.Post {
 			replace(&c.Backups.Run[i].Hooks.Post[j])
 		}
+		for j := range c.Backups.Run[i].Hooks.OnError {
+			replace(&c.Backups.Run[i].Hooks.OnError[j])
+		}
+		for j := range c.Backups.Run[i].Hooks.Finally {
+			replace(&c.Backups.Run[i].Hooks.Finally[j])
+		}
 		replace(&c.Backups.Run[i].Base)
 		for j := range c.Backups.Run[i].Paths {
 			replace(&c.Backups.Run[i].Paths[j])
 		}
 	}
+
+	for _, run := range c.Replication.Run {
+		replaceProviders(&Providers{Restic: run.From}, replace)
+		replaceProviders(&Providers{Restic: run.To}, replace)
+		replace(&run.ExtraArgs)
+	}
+
+	for _, n := range c.Notifications.Notify {
+		if n.Webhook != nil {
+			replace(&n.Webhook.URL)
+			for key, value := range n.Webhook.Headers {
+				n.Webhook.Headers[key] = os.ExpandEnv(value)
+			}
+		}
+		if n.Ntfy != nil {
+			replace(&n.Ntfy.URL)
+			n.Ntfy.Token = os.ExpandEnv(n.Ntfy.Token)
+		}
+		if n.Gotify != nil {
+			replace(&n.Gotify.URL)
+			n.Gotify.Token = os.ExpandEnv(n.Gotify.Token)
+		}
+		if n.SMTP != nil {
+			replace(&n.SMTP.Host)
+			n.SMTP.Password = os.ExpandEnv(n.SMTP.Password)
+		}
+	}
+	return nil
+}
+
+func replaceProviders(p *Providers, replace func(r *string)) {
+	if p.Restic != nil {
+		replace(&p.Restic.Repo)
+		replace(&p.Restic.ExtraArgs)
+	}
+	if p.Borg != nil {
+		replace(&p.Borg.Repo)
+		replace(&p.Borg.ExtraArgs)
+	}
+	if p.Kopia != nil {
+		replace(&p.Kopia.Repo)
+		replace(&p.Kopia.ExtraArgs)
+	}
+	if p.Rsync != nil {
+		replace(&p.Rsync.Dest)
+		replace(&p.Rsync.ExtraArgs)
+	}
+	if p.Archive != nil {
+		replace(&p.Archive.Dir)
+	}
+}
+
+func checkProviders(p *Providers, backup string) error {
+	if p.Archive != nil {
+		switch p.Archive.Format {
+		case "", "tar.zst", "tar.gz":
+		default:
+			return fmt.Errorf("invalid archive format `%s` for backup `%s`. valid formats are: tar.zst, tar.gz", p.Archive.Format, backup)
+		}
+	}
+	return nil
+}
+
+func checkIgnore(ignore *Ignore) error {
+	for _, name := range ignore.Files {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid ignore file name `%s`. it must be a file name, not a path", name)
+		}
+	}
+	for _, pattern := range append(ignore.Exclude, ignore.Include...) {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") || pattern == "/" {
+			return fmt.Errorf("invalid ignore pattern `%s`", pattern)
+		}
+	}
+	return nil
+}
+
+func checkNotifier(n *Notifier, i int) error {
+	set := 0
+	for _, isSet := range []bool{n.Webhook != nil, n.Ntfy != nil, n.Gotify != nil, n.SMTP != nil, n.Desktop != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("notifier %d: exactly one of webhook, ntfy, gotify, smtp and desktop must be set", i+1)
+	}
+
+	switch {
+	case n.Webhook != nil && n.Webhook.URL == "":
+		return fmt.Errorf("notifier %d: `url` of webhook is not set", i+1)
+	case n.Ntfy != nil && n.Ntfy.URL == "":
+		return fmt.Errorf("notifier %d: `url` of ntfy is not set", i+1)
+	case n.Gotify != nil && (n.Gotify.URL == "" || n.Gotify.Token == ""):
+		return fmt.Errorf("notifier %d: both `url` and `token` of gotify must be set", i+1)
+	case n.SMTP != nil && (n.SMTP.Host == "" || n.SMTP.From == "" || len(n.SMTP.To) == 0):
+		return fmt.Errorf("notifier %d: `host`, `from` and `to` of smtp must be set", i+1)
+	}
 	return nil
 }
 
@@ -185,9 +319,77 @@ func (c *Config) CheckNonService() error {
 		}
 	}
 
+	err := c.checkReplications()
+	if err != nil {
+		return err
+	}
+
+	for i, n := range c.Notifications.Notify {
+		err := checkNotifier(n, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.checkBackups()
+}
+
+func (c *Config) checkReplications() error {
+	names := make(map[string]bool)
+	for _, run := range c.Replication.Run {
+		if strings.TrimSpace(run.Name) == "" {
+			return fmt.Errorf("no name given to the replication config")
+		} else if names[run.Name] {
+			return fmt.Errorf("multiple replications with name: %s", run.Name)
+		}
+		names[run.Name] = true
+		if run.From == nil || run.To == nil {
+			return fmt.Errorf("both `from` and `to` must be set for replication `%s`", run.Name)
+		}
+		if run.Schedule != "" {
+			_, err := schedule.Parse(run.Schedule)
+			if err != nil {
+				return fmt.Errorf("invalid schedule of replication `%s`: %v", run.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Checks the backups, both as a service and not. Paths are left as they are written in the config.
+// They are joined with the base path when the backups are created.
+func (c *Config) checkBackups() error {
 	for _, run := range c.Backups.Run {
-		if run.Restic == nil {
-			return fmt.Errorf("config: field `restic` cannot be empty")
+		if run.Check != nil && run.Check.Every < 0 {
+			return fmt.Errorf("`every` field of check of backup `%s` cannot be negative", run.Name)
+		}
+		err := checkProviders(&run.Providers, run.Name)
+		if err != nil {
+			return err
+		}
+		for _, target := range run.Targets {
+			err = checkProviders(&target.Providers, run.Name)
+			if err != nil {
+				return err
+			}
+		}
+		if run.Schedule != "" {
+			_, err := schedule.Parse(run.Schedule)
+			if err != nil {
+				return fmt.Errorf("invalid schedule of backup `%s`: %v", run.Name, err)
+			}
+		}
+		err = checkIgnore(&run.Ignore)
+		if err != nil {
+			return fmt.Errorf("backup `%s`: %v", run.Name, err)
+		}
+		switch run.FailOn {
+		case "", FailOnAny, FailOnAll:
+		default:
+			return fmt.Errorf("invalid `fail_on` value `%s` for backup `%s`. valid values are: any, all", run.FailOn, run.Name)
+		}
+		if run.Retention != nil && run.Retention.IsEmpty() {
+			return fmt.Errorf("retention policy of backup `%s` is empty. set at least one `keep_*` field or remove `retention` from config", run.Name)
 		}
 		if run.Base != "" {
 			if !filepath.IsAbs(run.Base) {
@@ -195,7 +397,7 @@ func (c *Config) CheckNonService() error {
 			}
 			run.Base = filepath.ToSlash(run.Base)
 		}
-		for i, path := range run.Paths {
+		for _, path := range run.Paths {
 			if path == "" {
 				return fmt.Errorf("empty backup path. remove it or set it to a file/directory in config file")
 			}
@@ -203,8 +405,33 @@ func (c *Config) CheckNonService() error {
 			if !filepath.IsAbs(path) {
 				return fmt.Errorf("backup path `%s` is not absolute. to prevent confusion, ensure clarity by either setting the base path or setting paths to absolute paths", path)
 			}
-			path = filepath.ToSlash(path)
-			run.Paths[i] = path
+		}
+	}
+	return checkBorgPrefixes(c.Backups.Run)
+}
+
+// Archives of a borg backup are listed and pruned by their prefix. Prefixes of backups in
+// the same repository can't be the same, or start with each other.
+func checkBorgPrefixes(runs []*BackupRun) error {
+	type archives struct{ backup, prefix string }
+	repos := make(map[string][]archives)
+	for _, run := range runs {
+		providers := []*Providers{&run.Providers}
+		for _, target := range run.Targets {
+			providers = append(providers, &target.Providers)
+		}
+		for _, p := range providers {
+			if p.Borg == nil {
+				continue
+			}
+			repo := strings.TrimSuffix(filepath.ToSlash(p.Borg.Repo), "/")
+			prefix := p.Borg.Prefix(run.Name)
+			for _, other := range repos[repo] {
+				if other.backup != run.Name && (strings.HasPrefix(prefix, other.prefix) || strings.HasPrefix(other.prefix, prefix)) {
+					return fmt.Errorf("borg archive prefixes of backups `%s` and `%s` overlap in repository %s. set a different `archive_prefix` for one of them", other.backup, run.Name, repo)
+				}
+			}
+			repos[repo] = append(repos[repo], archives{backup: run.Name, prefix: prefix})
 		}
 	}
 	return nil
@@ -237,6 +464,22 @@ func (c *Config) CheckService() error {
 		if !filepath.IsAbs(run.Ifile) {
 			return fmt.Errorf("ifile path `%s` is not absolute. to avoid confusion, it must be absolute", run.Ifile)
 		}
+		err := checkIgnore(&run.Ignore)
+		if err != nil {
+			return fmt.Errorf("ifile `%s`: %v", run.Ifile, err)
+		}
 	}
-	return nil
+
+	for i, n := range c.Notifications.Notify {
+		err := checkNotifier(n, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := c.checkReplications()
+	if err != nil {
+		return err
+	}
+	return c.checkBackups()
 }
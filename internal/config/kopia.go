@@ -0,0 +1,9 @@
+package config
+
+type Kopia struct {
+	// Path of the filesystem repository.
+	Repo      string `mapstructure:"repo"`
+	Sudo      bool   `mapstructure:"sudo"`
+	ExtraArgs string `mapstructure:"extra_args"`
+	Password  string `mapstructure:"password"`
+}
@@ -0,0 +1,64 @@
+package config
+
+import "time"
+
+type (
+	Notifications struct {
+		// A backup is stale if it hasn't succeeded for this long. 0 disables stale backup notifications.
+		StaleAfter time.Duration `mapstructure:"stale_after"`
+
+		Notify []*Notifier `mapstructure:"notify"`
+	}
+
+	// Only one of the notifiers can be set.
+	Notifier struct {
+		// Events that trigger this notifier. If empty, all events except `backup_success` trigger it.
+		Events []string `mapstructure:"events"`
+
+		Webhook *Webhook `mapstructure:"webhook"`
+		Ntfy    *Ntfy    `mapstructure:"ntfy"`
+		Gotify  *Gotify  `mapstructure:"gotify"`
+		SMTP    *SMTP    `mapstructure:"smtp"`
+		Desktop *Desktop `mapstructure:"desktop"`
+	}
+
+	// Sends the notification as JSON with a POST request.
+	Webhook struct {
+		URL     string            `mapstructure:"url"`
+		Headers map[string]string `mapstructure:"headers"`
+	}
+
+	Ntfy struct {
+		// URL of the topic (e.g. `https://ntfy.sh/mytopic`).
+		URL string `mapstructure:"url"`
+		// Access token. Optional.
+		Token string `mapstructure:"token"`
+		// Either `min`, `low`, `default`, `high` or `max`. Optional.
+		Priority string `mapstructure:"priority"`
+	}
+
+	Gotify struct {
+		// URL of the Gotify server.
+		URL string `mapstructure:"url"`
+		// Token of the application.
+		Token    string `mapstructure:"token"`
+		Priority int    `mapstructure:"priority"`
+	}
+
+	SMTP struct {
+		Host string `mapstructure:"host"`
+		// Defaults to 587.
+		Port     int    `mapstructure:"port"`
+		Username string `mapstructure:"username"`
+		Password string `mapstructure:"password"`
+		From     string `mapstructure:"from"`
+		// Recipients of the email.
+		To []string `mapstructure:"to"`
+	}
+
+	// Shows a desktop notification with `notify-send`.
+	Desktop struct {
+		// Either `low`, `normal` or `critical`. Optional.
+		Urgency string `mapstructure:"urgency"`
+	}
+)
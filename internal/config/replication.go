@@ -0,0 +1,26 @@
+package config
+
+type (
+	Replication struct {
+		Run []*ReplicationRun `mapstructure:"run"`
+	}
+
+	// Copies snapshots from one restic repository to another with `restic copy`.
+	ReplicationRun struct {
+		Name string `mapstructure:"name"`
+
+		From *Restic `mapstructure:"from"`
+		To   *Restic `mapstructure:"to"`
+
+		// Only copy the snapshots of this host.
+		Host string `mapstructure:"host"`
+		// Only copy the snapshots with these tags.
+		Tags []string `mapstructure:"tags"`
+		// Extra arguments for `restic copy`.
+		ExtraArgs string `mapstructure:"extra_args"`
+
+		// How often the service runs this replication. Either an interval (e.g. `24h`),
+		// or a cron expression (e.g. `0 3 * * *`). If empty, it only runs with `kopyaship replicate`.
+		Schedule string `mapstructure:"schedule"`
+	}
+)
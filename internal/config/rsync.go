@@ -0,0 +1,14 @@
+package config
+
+type Rsync struct {
+	// Destination directory. It can also be a remote destination
+	// (e.g. `user@host:/path`) if `link_dest` and `delete` are disabled.
+	Dest      string `mapstructure:"dest"`
+	Sudo      bool   `mapstructure:"sudo"`
+	ExtraArgs string `mapstructure:"extra_args"`
+	// Delete files from the destination that don't exist in the source.
+	Delete bool `mapstructure:"delete"`
+	// Create a dated directory for every backup, hard linking the
+	// unchanged files to the previous one with `--link-dest`.
+	LinkDest bool `mapstructure:"link_dest"`
+}
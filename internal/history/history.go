@@ -0,0 +1,151 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	fileName   = "history.db"
+	bucketName = "runs"
+
+	// The database is opened by a single process at a time.
+	// Wait this long for other kopyaship processes to close it.
+	openTimeout = 10 * time.Second
+)
+
+type Kind string
+
+const (
+	KindBackup Kind = "backup"
+	KindForget Kind = "forget"
+	KindCheck  Kind = "check"
+	KindIfile  Kind = "ifile"
+)
+
+type (
+	// History is an append-only record of runs, persisted in the state directory.
+	History struct {
+		path string
+	}
+
+	Run struct {
+		ID   uint64 `json:"id"`
+		Kind Kind   `json:"kind"`
+		// Name of the backup, or path of the ifile.
+		Name     string        `json:"name"`
+		Start    time.Time     `json:"start"`
+		End      time.Time     `json:"end"`
+		Duration time.Duration `json:"duration"`
+		// Exit status of the backup program if it failed. 0 if the run was successful.
+		ExitStatus int    `json:"exit_status"`
+		Error      string `json:"error,omitempty"`
+
+		// Reported by backup programs that support it.
+		SnapshotID     string `json:"snapshot_id,omitempty"`
+		BytesAdded     uint64 `json:"bytes_added,omitempty"`
+		FilesProcessed uint64 `json:"files_processed,omitempty"`
+	}
+
+	Filter struct {
+		// If empty, runs of all backups and ifiles are returned.
+		Name string
+		// If zero, all runs are returned.
+		Since time.Time
+	}
+)
+
+func Open(stateDir string) *History {
+	return &History{path: filepath.Join(stateDir, fileName)}
+}
+
+// Start returns a run that starts now. Call Finish on it when it ends.
+func Start(kind Kind, name string) *Run {
+	return &Run{Kind: kind, Name: name, Start: time.Now()}
+}
+
+// Finish ends the run with the given result.
+func (r *Run) Finish(err error) *Run {
+	r.End = time.Now()
+	r.Duration = r.End.Sub(r.Start)
+	if err != nil {
+		r.Error = err.Error()
+		r.ExitStatus = 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			r.ExitStatus = exitErr.ExitCode()
+		}
+	}
+	return r
+}
+
+func (r *Run) Successful() bool { return r.Error == "" }
+
+func (h *History) db() (*bolt.DB, error) {
+	return bolt.Open(h.path, 0644, &bolt.Options{Timeout: openTimeout})
+}
+
+// Add records the run and assigns an ID to it.
+func (h *History) Add(r *Run) error {
+	db, err := h.db()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucketName))
+		if err != nil {
+			return err
+		}
+		r.ID, err = b.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, r.ID)
+		return b.Put(key, data)
+	})
+}
+
+// Runs returns the runs matching the filter, from oldest to newest.
+func (h *History) Runs(filter *Filter) (runs []*Run, err error) {
+	db, err := h.db()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			r := &Run{}
+			err := json.Unmarshal(v, r)
+			if err != nil {
+				return err
+			}
+			if filter.Name != "" && r.Name != filter.Name {
+				return nil
+			}
+			if !filter.Since.IsZero() && r.Start.Before(filter.Since) {
+				return nil
+			}
+			runs = append(runs, r)
+			return nil
+		})
+	})
+	return
+}
@@ -0,0 +1,51 @@
+package history
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	h := Open(t.TempDir())
+
+	runs, err := h.Runs(&Filter{})
+	require.NoError(t, err)
+	require.Empty(t, runs)
+
+	old := Start(KindBackup, "home")
+	old.Start = old.Start.Add(-48 * time.Hour)
+	require.NoError(t, h.Add(old.Finish(nil)))
+	require.NoError(t, h.Add(Start(KindCheck, "home").Finish(errors.New("pack is damaged"))))
+	require.NoError(t, h.Add(Start(KindBackup, "documents").Finish(nil)))
+
+	runs, err = h.Runs(&Filter{})
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	for i, r := range runs {
+		require.Equal(t, uint64(i+1), r.ID)
+	}
+	require.True(t, runs[0].Successful())
+	require.Equal(t, "pack is damaged", runs[1].Error)
+	require.Equal(t, 1, runs[1].ExitStatus)
+
+	runs, err = h.Runs(&Filter{Name: "home", Since: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, KindCheck, runs[0].Kind)
+}
+
+func TestExitStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	require.Error(t, err)
+	r := Start(KindBackup, "home").Finish(err)
+	require.Equal(t, 3, r.ExitStatus)
+	require.False(t, r.Successful())
+}
@@ -0,0 +1,151 @@
+package ifile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pathspec "github.com/tomruk/go-pathspec"
+)
+
+// Explanation tells why a path is included in or excluded from an ifile.
+type Explanation struct {
+	Path    string `json:"path"`
+	Ignored bool   `json:"ignored"`
+	// The ignore file that has the deciding pattern. Empty if no pattern matches the path.
+	// If the pattern is given in config, this is InlinePatterns.
+	Ignorefile string `json:"ignorefile,omitempty"`
+	// Line number of the pattern in the ignore file, starting from 1. If the pattern
+	// is given in config, this is its position among the patterns.
+	Line    int    `json:"line,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	// If the path is ignored because one of its parent directories is ignored, path of that directory.
+	IgnoredParent string `json:"ignored_parent,omitempty"`
+}
+
+// Shown in place of an ignore file if the pattern is given in config.
+const InlinePatterns = "<patterns in config>"
+
+// Explain tells which pattern of which ignore file decides whether path is ignored,
+// when root is walked. Ignore files are read and matched the same way Walk does.
+// If opts is nil, DefaultWalkOptions is used.
+func Explain(root, path string, opts *WalkOptions) (*Explanation, error) {
+	if opts == nil {
+		opts = DefaultWalkOptions()
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is not in %s", path, root)
+	}
+
+	e := &Explanation{Path: path}
+	if rel == "." {
+		// Walk doesn't match the root against any pattern.
+		return e, nil
+	}
+
+	ignorefiles := make([]*ignorefile, 0, 10)
+	err = opts.addRoot(&ignorefiles, root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parent directories are walked first. If one of them is ignored, Walk skips it along with its contents.
+	current := root
+	components := strings.Split(rel, string(filepath.Separator))
+	for i, component := range components {
+		current = filepath.Join(current, component)
+		last := i == len(components)-1
+
+		isDir := !last
+		if last {
+			info, err := os.Lstat(current)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			isDir = info != nil && info.IsDir()
+		}
+		if isDir {
+			err = opts.addIgnorefiles(&ignorefiles, current)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ignored, igFile, pattern := match(ignorefiles, current, isDir)
+		if ignored || last {
+			e.Ignored = ignored
+			if ignored && !last {
+				e.IgnoredParent = current
+			}
+			if pattern != nil {
+				e.Ignorefile = igFile.path
+				if igFile.inline {
+					e.Ignorefile = InlinePatterns
+				}
+				e.Pattern = pattern.Pattern()
+				e.Line, err = patternLine(igFile, pattern)
+				if err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+	}
+	return e, nil
+}
+
+// Find the line number of the pattern by skipping the lines pathspec skips.
+func patternLine(igFile *ignorefile, pattern *pathspec.Pattern) (int, error) {
+	index := -1
+	for i, p := range igFile.p.Patterns {
+		if p == pattern {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return 0, nil
+	} else if igFile.inline {
+		return index + 1, nil
+	}
+
+	f, err := os.Open(igFile.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.HasSuffix(text, `\ `) {
+			text = strings.TrimLeft(text, " ")
+		} else {
+			text = strings.TrimSpace(text)
+		}
+		if text == "" || text[0] == '#' || text == "/" {
+			continue
+		}
+		if index == 0 {
+			return line, nil
+		}
+		index--
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,114 @@
+package ifile
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestExplain(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		".gitignore": `# Build output
+build/
+
+*.log
+!keep.log
+`,
+		"src/.ksignore":  "\n\\#notes\n  secret\n",
+		"src/main.go":    "",
+		"src/secret":     "",
+		"src/#notes":     "",
+		"build/out/bin":  "",
+		"debug.log":      "",
+		"keep.log":       "",
+		"docs/guide.txt": "",
+	} {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	for _, tc := range []struct {
+		path string
+		want *Explanation
+	}{
+		{
+			path: "docs/guide.txt",
+			want: &Explanation{},
+		},
+		{
+			path: "debug.log",
+			want: &Explanation{Ignored: true, Ignorefile: ".gitignore", Line: 4, Pattern: "*.log"},
+		},
+		{
+			path: "keep.log",
+			want: &Explanation{Ignored: false, Ignorefile: ".gitignore", Line: 5, Pattern: "!keep.log"},
+		},
+		{
+			path: "build",
+			want: &Explanation{Ignored: true, Ignorefile: ".gitignore", Line: 2, Pattern: "build/"},
+		},
+		{
+			path: "build/out/bin",
+			want: &Explanation{Ignored: true, Ignorefile: ".gitignore", Line: 2, Pattern: "build/", IgnoredParent: "build"},
+		},
+		{
+			path: "src/secret",
+			want: &Explanation{Ignored: true, Ignorefile: "src/.ksignore", Line: 3, Pattern: "secret"},
+		},
+		{
+			path: "src/#notes",
+			want: &Explanation{Ignored: true, Ignorefile: "src/.ksignore", Line: 2, Pattern: `\#notes`},
+		},
+		{
+			// Paths that don't exist are explained too.
+			path: "src/old.log",
+			want: &Explanation{Ignored: true, Ignorefile: ".gitignore", Line: 4, Pattern: "*.log"},
+		},
+	} {
+		tc.want.Path = filepath.Join(root, tc.path)
+		if tc.want.Ignorefile != "" {
+			tc.want.Ignorefile = filepath.Join(root, tc.want.Ignorefile)
+		}
+		if tc.want.IgnoredParent != "" {
+			tc.want.IgnoredParent = filepath.Join(root, tc.want.IgnoredParent)
+		}
+
+		e, err := Explain(root, filepath.Join(root, tc.path), nil)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, e, tc.path)
+	}
+
+	_, err := Explain(filepath.Join(root, "src"), filepath.Join(root, "docs"), nil)
+	require.Error(t, err)
+
+	// Explanations agree with the files listed by Walk.
+	ifilePath := filepath.Join(t.TempDir(), "ifile")
+	i, err := New(ifilePath, ModeRestic, false, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, i.Walk(root))
+	require.NoError(t, i.Close())
+	content, err := os.ReadFile(ifilePath)
+	require.NoError(t, err)
+	listed := make(map[string]bool)
+	for _, line := range strings.Split(string(content), "\n") {
+		listed[line] = true
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		e, err := Explain(root, path, nil)
+		require.NoError(t, err)
+		require.Equal(t, !listed[filepath.ToSlash(path)], e.Ignored, path)
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,84 @@
+package ifile
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Returns the line of the entry in an ifile of the given mode.
+func (e *entry) line(mode Mode) string {
+	switch mode {
+	case ModeRsync:
+		return e.rsyncRule()
+	case ModeBorg:
+		return e.borgPattern()
+	case ModeKopia:
+		return e.kopiaignoreRule()
+	case ModeRclone:
+		return e.rcloneRule()
+	default:
+		return e.String()
+	}
+}
+
+// Path of a relative entry, with forward slashes and a leading slash, which anchors it to the walked directory.
+func (e *entry) anchored() string {
+	path := filepath.ToSlash(e.path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// Returns an exclude rule of rsync. Directories are excluded along with their contents (`***`).
+//
+// Backslashes escape wildcard characters only if the pattern has a wildcard.
+// Otherwise, they are matched literally.
+func (e *entry) rsyncRule() string {
+	path := e.anchored()
+	if e.isDir {
+		return "- " + rsyncEscaper.Replace(path) + "/***\n"
+	} else if strings.ContainsAny(path, "*?[") {
+		path = rsyncEscaper.Replace(path)
+	}
+	return "- " + path + "\n"
+}
+
+var rsyncEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// Returns an exclude pattern of borg. Paths are matched literally with the `pf:` (full path) and
+// `pp:` (path prefix) styles, so they are not escaped. Directories are excluded with `!`, so that
+// borg doesn't walk into them.
+func (e *entry) borgPattern() string {
+	path := filepath.ToSlash(e.path)
+	if e.isDir {
+		return "! pp:" + path + "\n"
+	}
+	return "- pf:" + path + "\n"
+}
+
+// Returns a rule of .kopiaignore, which has the same syntax as .gitignore.
+func (e *entry) kopiaignoreRule() string {
+	path := gitignoreEscaper.Replace(e.anchored())
+	// Trailing spaces are ignored unless they are escaped.
+	if trimmed := strings.TrimRight(path, " "); len(trimmed) != len(path) {
+		path = trimmed + strings.Repeat(`\ `, len(path)-len(trimmed))
+	}
+	if e.isDir {
+		path += "/"
+	}
+	return path + "\n"
+}
+
+var gitignoreEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// Returns an exclude rule of rclone. Directories are excluded along with their contents (`**`).
+func (e *entry) rcloneRule() string {
+	path := rcloneEscaper.Replace(e.anchored())
+	if e.isDir {
+		path += "/**"
+	}
+	return "- " + path + "\n"
+}
+
+var rcloneEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`, "{", `\{`, "}", `\}`)
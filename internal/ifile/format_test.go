@@ -0,0 +1,95 @@
+package ifile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseMode(t *testing.T) {
+	for _, m := range modes {
+		parsed, err := ParseMode(m.String())
+		require.NoError(t, err)
+		require.Equal(t, m, parsed)
+	}
+	_, err := ParseMode("unison")
+	require.Error(t, err)
+}
+
+func TestFormats(t *testing.T) {
+	for _, tc := range []struct {
+		entry *entry
+		mode  Mode
+		line  string
+	}{
+		{&entry{path: "/a/b"}, ModeRsync, "- /a/b\n"},
+		{&entry{path: "a/b"}, ModeRsync, "- /a/b\n"},
+		{&entry{path: "/a/b", isDir: true}, ModeRsync, "- /a/b/***\n"},
+		// Backslashes are literal if there is no wildcard.
+		{&entry{path: `/a\b`}, ModeRsync, `- /a\b` + "\n"},
+		{&entry{path: `/a\b*`}, ModeRsync, `- /a\\b\*` + "\n"},
+		{&entry{path: "/[a]?"}, ModeRsync, `- /\[a]\?` + "\n"},
+		{&entry{path: `/a\*b`, isDir: true}, ModeRsync, `- /a\\\*b/***` + "\n"},
+
+		{&entry{path: "/home/user/a b"}, ModeBorg, "- pf:/home/user/a b\n"},
+		{&entry{path: "/home/user/[*]", isDir: true}, ModeBorg, "! pp:/home/user/[*]\n"},
+
+		{&entry{path: "/a/b"}, ModeKopia, "/a/b\n"},
+		{&entry{path: "/a/b", isDir: true}, ModeKopia, "/a/b/\n"},
+		{&entry{path: `/#!a\*?[b]`}, ModeKopia, `/#!a\\\*\?\[b]` + "\n"},
+		{&entry{path: "/a  "}, ModeKopia, `/a\ \ ` + "\n"},
+
+		{&entry{path: "/a/b"}, ModeRclone, "- /a/b\n"},
+		{&entry{path: "/a/b", isDir: true}, ModeRclone, "- /a/b/**\n"},
+		{&entry{path: `/{a}[b]*?\`}, ModeRclone, `- /\{a\}\[b\]\*\?\\` + "\n"},
+
+		{&entry{path: "/a/[b]"}, ModeSyncthing, `/a/\[b\]` + "\n"},
+	} {
+		require.Equal(t, tc.line, tc.entry.line(tc.mode), "%s: %s", tc.mode, tc.entry.path)
+	}
+}
+
+func TestWalkFormats(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":      "build/\n*.log\n!keep.log\n",
+		"build/out":       "",
+		"build2/out.log":  "",
+		"src/a.log":       "",
+		"src/keep.log":    "",
+		"src/[draft].log": "",
+		"src/main.go":     "",
+	})
+	slashRoot := filepath.ToSlash(root)
+
+	for mode, want := range map[Mode][]string{
+		ModeRsync:  {"- /build/***", "- /build2/out.log", "- /src/a.log", `- /src/\[draft].log`},
+		ModeRclone: {"- /build/**", "- /build2/out.log", "- /src/a.log", `- /src/\[draft\].log`},
+		ModeKopia:  {"/build/", "/build2/out.log", "/src/a.log", `/src/\[draft].log`},
+		ModeBorg: {
+			"! pp:" + slashRoot + "/build",
+			"- pf:" + slashRoot + "/build2/out.log",
+			"- pf:" + slashRoot + "/src/a.log",
+			"- pf:" + slashRoot + "/src/[draft].log",
+		},
+	} {
+		ifilePath := filepath.Join(t.TempDir(), "ifile")
+		i, err := New(ifilePath, mode, true, zap.NewNop())
+		require.NoError(t, err)
+		require.NoError(t, i.Walk(root))
+		require.NoError(t, i.Close())
+
+		content, err := os.ReadFile(ifilePath)
+		require.NoError(t, err)
+		lines := strings.Split(string(content), "\n")
+		for _, line := range want {
+			require.Contains(t, lines, line, mode.String())
+		}
+		require.NotContains(t, string(content), "keep.log", mode.String())
+		require.NotContains(t, string(content), "main.go", mode.String())
+	}
+}
@@ -1,11 +1,14 @@
 package ifile
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
@@ -18,25 +21,44 @@ type (
 		log  *zap.Logger
 		logS *zap.SugaredLogger
 		mode Mode
+		opts *WalkOptions
 
-		buf   bytes.Buffer
-		bufMu sync.Mutex
-		end   []byte
+		// Content before and after the generated entries.
+		head bytes.Buffer
+		end  []byte
+		// Entries written by Walk calls, which are put between head and end on Close.
+		parts   []*part
+		partsMu sync.Mutex
 
 		filePath string
-		file     *os.File
-		once     sync.Once
+		// Content of the ifile before it is generated (only read if appendToExisting), and whether it exists.
+		existing         []byte
+		exists           bool
+		perm             os.FileMode
+		appendToExisting bool
+		once             sync.Once
 	}
 
 	entry struct {
 		path  string
 		isDir bool
 	}
-	entries []*entry
+
+	// A temporary file, which holds the entries of a Walk call.
+	part struct {
+		root string
+		path string
+	}
 
 	ignorefile struct {
-		p   *pathspec.PathSpec
+		p *pathspec.PathSpec
+		// Patterns of p, compiled to match only the path itself.
+		res []*regexp.Regexp
 		dir string
+		// Path of the ignore file. Empty if inline is true.
+		path string
+		// Whether the patterns are given in config instead of an ignore file.
+		inline bool
 	}
 
 	Mode int
@@ -47,19 +69,63 @@ const (
 	ModeRestic Mode = iota
 	// Ignore file. Paths are relative to the .gitignore/.ksignore.
 	ModeSyncthing
+	// Filter file of rsync, which can be read with `--exclude-from` or `--filter`.
+	// Rules are anchored to the walked directory.
+	ModeRsync
+	// Patterns file of borg, which can be read with `--patterns-from`. Paths are absolute.
+	ModeBorg
+	// .kopiaignore file. Paths are relative to the walked directory.
+	ModeKopia
+	// Filter file of rclone, which can be read with `--filter-from`.
+	// Rules are anchored to the walked directory.
+	ModeRclone
+	// Ignore file of syncthing, like ModeSyncthing. Instead of listing every ignored path,
+	// patterns of the ignore files are translated to syncthing patterns.
+	ModeSyncthingPatterns
 )
 
+var modes = []Mode{ModeRestic, ModeSyncthing, ModeRsync, ModeBorg, ModeKopia, ModeRclone, ModeSyncthingPatterns}
+
 func (m Mode) String() string {
 	switch m {
 	case ModeRestic:
 		return "restic"
 	case ModeSyncthing:
 		return "syncthing"
+	case ModeRsync:
+		return "rsync"
+	case ModeBorg:
+		return "borg"
+	case ModeKopia:
+		return "kopia"
+	case ModeRclone:
+		return "rclone"
+	case ModeSyncthingPatterns:
+		return "syncthing_patterns"
 	default:
 		return "<invalid mode>"
 	}
 }
 
+// ParseMode returns the mode with the given name, as in the `type` field of ifile generations.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range modes {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	names := make([]string, len(modes))
+	for i, m := range modes {
+		names[i] = m.String()
+	}
+	return 0, fmt.Errorf("invalid ifile type: %s. valid types are: %s", s, strings.Join(names, ", "))
+}
+
+// Whether the paths are relative to the walked directory.
+func (m Mode) relative() bool {
+	return m == ModeSyncthing || m == ModeRsync || m == ModeKopia || m == ModeRclone
+}
+
 const (
 	generatedBy    = "# Generated by kopyaship. DO NOT TOUCH THE LINES BETWEEN I_BEGIN AND I_END."
 	beginIndicator = "# I_BEGIN"
@@ -73,18 +139,27 @@ func New(
 	log *zap.Logger,
 ) (ifile *Ifile, err error) {
 	ifile = &Ifile{
-		log:      log,
-		logS:     log.Sugar(),
-		mode:     mode,
-		filePath: filePath,
+		log:              log,
+		logS:             log.Sugar(),
+		mode:             mode,
+		opts:             DefaultWalkOptions(),
+		filePath:         filePath,
+		perm:             0660,
+		appendToExisting: appendToExisting,
 	}
 
-	flags := os.O_CREATE | os.O_RDWR
-	if !appendToExisting {
-		flags |= os.O_TRUNC
-	}
-	ifile.file, err = os.OpenFile(ifile.filePath, flags, 0660)
-	if err != nil {
+	// Nothing is written until Close. Until then, the existing ifile is left as it is.
+	info, err := os.Stat(filePath)
+	if err == nil {
+		if appendToExisting {
+			ifile.existing, err = os.ReadFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ifile.exists = true
+		ifile.perm = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
 		return nil, err
 	}
 
@@ -94,20 +169,19 @@ func New(
 			return nil, err
 		}
 	} else {
-		ifile.buf.WriteString(generatedBy + "\n")
-		ifile.buf.WriteString(beginIndicator + "\n")
+		ifile.head.WriteString(generatedBy + "\n")
+		ifile.head.WriteString(beginIndicator + "\n")
 		ifile.end = append(ifile.end, []byte(endIndicator+"\n")...)
 	}
-	return
+	return ifile, nil
 }
 
-func (i *Ifile) seekToEnd() error {
-	content, err := io.ReadAll(i.file)
-	if err != nil {
-		return err
-	}
+// SetWalkOptions sets the sources of ignore patterns. By default, DefaultWalkOptions is used.
+func (i *Ifile) SetWalkOptions(o *WalkOptions) { i.opts = o }
 
-	content = bytes.ReplaceAll(content, []byte{'\r', '\n'}, []byte{'\n'})
+func (i *Ifile) seekToEnd() error {
+	// To apply potential newline seperator change.
+	content := bytes.ReplaceAll(i.existing, []byte{'\r', '\n'}, []byte{'\n'})
 	splitted := bytes.Split(content, []byte{'\n'})
 
 	begin := -1
@@ -132,75 +206,194 @@ func (i *Ifile) seekToEnd() error {
 
 	i.logS.Debugf("ifile: %s: begin %d, end %d", i.filePath, begin, end)
 
-	// To apply potential newline seperator change.
-	_, err = i.file.Seek(0, io.SeekStart)
-	if err != nil {
-		return err
-	}
-	err = i.file.Truncate(0)
-	if err != nil {
-		return err
-	}
-	_, err = i.file.Write(content)
-	if err != nil {
-		return err
+	if begin == -1 && end == -1 {
+		i.head.Write(content)
+		i.head.WriteString(generatedBy + "\n")
+		i.head.WriteString(beginIndicator + "\n")
+		i.end = append(i.end, []byte(endIndicator+"\n")...)
+	} else {
+		i.head.Write(content[:begin+len(beginIndicator)+1])
+		i.end = content[end:]
 	}
+	return nil
+}
 
-	if begin == -1 && end == -1 {
-		_, err := i.file.Seek(0, io.SeekEnd)
+// Close writes the ifile. It is written to a temporary file in the same directory,
+// which then replaces the ifile, so that programs reading the ifile never see it half-written.
+// If the ifile exists, the previous ifile is kept with the `.kopyaship.bak` suffix.
+// If the content is not changed, neither the ifile nor the previous ifile is touched.
+func (i *Ifile) Close() (err error) {
+	i.once.Do(func() {
+		i.partsMu.Lock()
+		defer i.partsMu.Unlock()
+		defer func() {
+			for _, p := range i.parts {
+				os.Remove(p.path)
+			}
+		}()
+		// Walk calls might be concurrent. Sort the parts so that the content doesn't depend on their order.
+		sort.SliceStable(i.parts, func(a, b int) bool { return i.parts[a].root < i.parts[b].root })
+
+		var tempPath string
+		tempPath, err = writeTemp(i.filePath, i.perm, i.writeContent)
 		if err != nil {
-			return err
+			return
 		}
-		i.buf.WriteString(generatedBy + "\n")
-		i.buf.WriteString(beginIndicator + "\n")
-		i.end = append(i.end, []byte(endIndicator+"\n")...)
-	} else {
-		seek := int64(begin + len(beginIndicator) + 1)
-		err = i.file.Truncate(seek)
+		defer os.Remove(tempPath) // Has no effect after a successful rename.
+
+		if i.exists {
+			var same bool
+			same, err = sameContent(tempPath, i.filePath)
+			if err != nil {
+				return
+			} else if same {
+				i.logS.Debugf("ifile: %s: not changed, skipping", i.filePath)
+				return
+			}
+		}
+		if i.exists {
+			i.logS.Debugf("ifile: %s: keeping the previous ifile", i.filePath)
+			err = copyFileAtomic(i.filePath, i.filePath+backupSuffix, i.perm)
+			if err != nil {
+				return
+			}
+		}
+		i.logS.Debugf("ifile: %s: writing", i.filePath)
+		err = os.Rename(tempPath, i.filePath)
+	})
+	return
+}
+
+func (i *Ifile) writeContent(w io.Writer) error {
+	_, err := w.Write(i.head.Bytes())
+	if err != nil {
+		return err
+	}
+	for _, p := range i.parts {
+		f, err := os.Open(p.path)
 		if err != nil {
 			return err
 		}
-		_, err = i.file.Seek(seek, io.SeekStart)
+		_, err = io.Copy(w, f)
+		f.Close()
 		if err != nil {
 			return err
 		}
-		i.end = content[end:]
 	}
-	return nil
+	if len(i.end) != 0 {
+		_, err = w.Write(i.end)
+	} else {
+		_, err = w.Write([]byte{'\n'})
+	}
+	return err
 }
 
-func (i *Ifile) Close() (err error) {
-	var (
-		err1 error
-		err2 error
-	)
-	i.once.Do(func() {
-		i.logS.Debugf("ifile: %s: writing i.buf", i.filePath)
-		_, err1 = i.file.Write(i.buf.Bytes())
-		if len(i.end) != 0 {
-			i.logS.Debugf("ifile: %s: writing i.end", i.filePath)
-			_, err2 = i.file.Write(i.end)
-		} else {
-			i.logS.Debugf("ifile: %s: writing newline", i.filePath)
-			_, err2 = i.file.WriteString("\n")
-		}
-		i.file.Close()
+const (
+	backupSuffix = ".kopyaship.bak"
+	tempInfix    = ".kopyaship.tmp"
+)
+
+// Copy src to a temporary file in the directory of dst, then rename it to dst.
+func copyFileAtomic(src, dst string, perm os.FileMode) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tempPath, err := writeTemp(dst, perm, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
 	})
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tempPath, dst)
+	if err != nil {
+		os.Remove(tempPath)
+	}
+	return err
+}
+
+// Create a temporary file in the directory of path, and write its content with write.
+func writeTemp(path string, perm os.FileMode, write func(w io.Writer) error) (tempPath string, err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+tempInfix+"*")
+	if err != nil {
+		return "", err
+	}
+	tempPath = f.Name()
 
-	// Prioritize err1
-	if err1 != nil {
-		i.logS.Debugf("ifile: %s: err1 occured", i.filePath)
-		err = err1
-	} else if err2 != nil {
-		i.logS.Debugf("ifile: %s: err2 occured", i.filePath)
-		err = err2
+	w := bufio.NewWriterSize(f, 64*1024)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
+	return tempPath, nil
+}
+
+// Tells whether the files have the same content, without reading them into memory.
+func sameContent(path1, path2 string) (bool, error) {
+	info1, err := os.Stat(path1)
+	if err != nil {
+		return false, err
+	}
+	info2, err := os.Stat(path2)
+	if err != nil {
+		return false, err
+	}
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+
+	f1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer f1.Close()
+	f2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer f2.Close()
+
+	buf1 := make([]byte, 64*1024)
+	buf2 := make([]byte, 64*1024)
+	for {
+		n1, err1 := io.ReadFull(f1, buf1)
+		n2, err2 := io.ReadFull(f2, buf2)
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		eof1 := err1 == io.EOF || err1 == io.ErrUnexpectedEOF
+		eof2 := err2 == io.EOF || err2 == io.ErrUnexpectedEOF
+		if eof1 && eof2 {
+			return true, nil
+		} else if err1 != nil && !eof1 {
+			return false, err1
+		} else if err2 != nil && !eof2 {
+			return false, err2
+		} else if eof1 || eof2 {
+			return false, nil
+		}
 	}
-	return
 }
 
-func (e *entry) Len() int {
-	// + 1 is for newline; + 10 is for potential '\[' and '\]'
-	return len(e.path) + 1 + 10
+// Tells whether the file is the previous version of an ifile, or an ifile that is being written.
+func isOwnFile(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasSuffix(base, backupSuffix) || strings.Contains(base, tempInfix)
 }
 
 func (e *entry) String() string {
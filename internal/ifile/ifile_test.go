@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -22,6 +23,7 @@ var testIfile = func(suffix string) string {
 // Test whether it truncates the old ifile contents when appendToExisting is false.
 func TestIfileOverwrite(t *testing.T) {
 	testIfile := testIfile("ifile_overwrite")
+	defer os.Remove(testIfile + backupSuffix)
 	ifileFormRe := regexp.MustCompile(fmt.Sprintf("^.*%s\n%s\n([/a-zA-Z0-9-_. !#]+\n)+%s\n$",
 		regexp.QuoteMeta(generatedBy),
 		regexp.QuoteMeta(beginIndicator),
@@ -57,6 +59,7 @@ func TestIfileOverwrite(t *testing.T) {
 // Test whether it successfully adds entries between beginIndiator and endIndicator, preserving old contents when appendToExisting is true.
 func TestIfileAppend(t *testing.T) {
 	testIfile := testIfile("ifile_append")
+	defer os.Remove(testIfile + backupSuffix)
 	content := []byte(`# This is a comment.
 
 /this/is/a/test/entry
@@ -102,6 +105,7 @@ func TestIfileAppend(t *testing.T) {
 // Test whether it successfully adds entries between beginIndiator and endIndicator, preserving old contents when appendToExisting is true.
 func TestIfileAppend2(t *testing.T) {
 	testIfile := testIfile("ifile_append2")
+	defer os.Remove(testIfile + backupSuffix)
 	contentStart := `# This is a comment.
 
 /this/is/a/test/entry
@@ -153,3 +157,69 @@ func TestIfileAppend2(t *testing.T) {
 
 	require.True(t, ifileFormRe.Match(content))
 }
+
+func TestIfileAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.MkdirAll(root, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.tmp\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.tmp"), nil, 0644))
+
+	stignore := filepath.Join(dir, ".stignore")
+	previous := []byte("/previous\n")
+	require.NoError(t, os.WriteFile(stignore, previous, 0600))
+
+	generate := func() {
+		i, err := New(stignore, ModeSyncthing, true, zap.NewNop())
+		require.NoError(t, err)
+		require.NoError(t, i.Walk(root))
+		require.NoError(t, i.Close())
+	}
+
+	// Nothing is written before Close.
+	i, err := New(stignore, ModeSyncthing, true, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, i.Walk(root))
+	content, err := os.ReadFile(stignore)
+	require.NoError(t, err)
+	require.Equal(t, previous, content)
+	require.NoError(t, i.Close())
+	content, err = os.ReadFile(stignore)
+	require.NoError(t, err)
+	require.Equal(t, string(previous)+generatedBy+"\n"+beginIndicator+"\n/a.tmp\n"+endIndicator+"\n", string(content))
+	backup, err := os.ReadFile(stignore + backupSuffix)
+	require.NoError(t, err)
+	require.Equal(t, previous, backup)
+
+	info, err := os.Stat(stignore)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Identical content is not written again, so the backup is kept.
+	generate()
+	backup, err = os.ReadFile(stignore + backupSuffix)
+	require.NoError(t, err)
+	require.Equal(t, previous, backup)
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for _, e := range entries {
+		require.False(t, strings.Contains(e.Name(), tempInfix), e.Name())
+	}
+
+	// The previous ifile is kept when it is overwritten too.
+	overwritten := filepath.Join(t.TempDir(), ".stignore")
+	require.NoError(t, os.WriteFile(overwritten, previous, 0600))
+	i, err = New(overwritten, ModeSyncthing, false, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, i.Walk(root))
+	require.NoError(t, i.Close())
+	content, err = os.ReadFile(overwritten)
+	require.NoError(t, err)
+	require.Equal(t, generatedBy+"\n"+beginIndicator+"\n/a.tmp\n"+endIndicator+"\n", string(content))
+	backup, err = os.ReadFile(overwritten + backupSuffix)
+	require.NoError(t, err)
+	require.Equal(t, previous, backup)
+}
@@ -0,0 +1,263 @@
+package ifile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	pathspec "github.com/tomruk/go-pathspec"
+	"github.com/tomruk/kopyaship/internal/config"
+)
+
+// WalkOptions configures the sources of ignore patterns that are read while walking.
+type WalkOptions struct {
+	// Names of the ignore files that are read in every directory.
+	// Later ones take precedence over earlier ones.
+	Ignorefiles []string
+	// Patterns in gitignore format that apply at the root of the walked path.
+	// They take precedence over the ignore files in the root, but not over the
+	// ones in its subdirectories.
+	Patterns []string
+	// Read `.git/info/exclude` of git repositories.
+	GitInfoExclude bool
+	// Read the global excludes file of git (`core.excludesFile`) in git repositories.
+	GitGlobalExcludes bool
+}
+
+func DefaultWalkOptions() *WalkOptions {
+	return &WalkOptions{
+		Ignorefiles:       []string{gitignore, ksignore},
+		GitInfoExclude:    true,
+		GitGlobalExcludes: true,
+	}
+}
+
+// WalkOptionsFromConfig returns the walk options of the `ignore` section of a backup or an ifile generation.
+func WalkOptionsFromConfig(c *config.Ignore) *WalkOptions {
+	o := DefaultWalkOptions()
+	if len(c.Files) > 0 {
+		o.Ignorefiles = c.Files
+	}
+	o.Patterns = append(o.Patterns, c.Exclude...)
+	for _, include := range c.Include {
+		o.Patterns = append(o.Patterns, "!"+include)
+	}
+	if c.GitInfoExclude != nil {
+		o.GitInfoExclude = *c.GitInfoExclude
+	}
+	if c.GitGlobalExcludes != nil {
+		o.GitGlobalExcludes = *c.GitGlobalExcludes
+	}
+	return o
+}
+
+// Add the ignore files of the root of a walk, along with the patterns of o.
+func (o *WalkOptions) addRoot(ignorefiles *[]*ignorefile, root string) error {
+	err := o.addIgnorefiles(ignorefiles, root)
+	if err != nil || len(o.Patterns) == 0 {
+		return err
+	}
+	p, err := pathspec.FromLines(o.Patterns...)
+	if err != nil {
+		return err
+	}
+	igFile, err := newIgnorefile(p, root, "")
+	if err != nil {
+		return err
+	}
+	igFile.inline = true
+	*ignorefiles = append(*ignorefiles, igFile)
+	return nil
+}
+
+// Add the ignore files of dir. Ignore files are matched starting from the last one,
+// so they are added from the lowest precedence to the highest, as git does:
+// the global excludes file, .git/info/exclude, and then the ignore files of dir.
+func (o *WalkOptions) addIgnorefiles(ignorefiles *[]*ignorefile, dir string) error {
+	err := o.addGitExcludes(ignorefiles, dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range o.Ignorefiles {
+		err := addIgnoreIfExists(ignorefiles, dir, filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add the excludes files of git, if dir is the top-level directory of a git repository.
+func (o *WalkOptions) addGitExcludes(ignorefiles *[]*ignorefile, dir string) error {
+	if !o.GitInfoExclude && !o.GitGlobalExcludes {
+		return nil
+	}
+	gitDir := findGitDir(dir)
+	if gitDir == "" {
+		return nil
+	}
+	if o.GitGlobalExcludes {
+		if path := globalExcludesFile(); path != "" {
+			err := addIgnoreIfExists(ignorefiles, dir, path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if o.GitInfoExclude {
+		return addIgnoreIfExists(ignorefiles, dir, filepath.Join(gitDir, "info", "exclude"))
+	}
+	return nil
+}
+
+// GitExcludePatterns returns the patterns of the excludes files of git (see GitInfoExclude and
+// GitGlobalExcludes) of the git repositories in root. It is for backup programs that read ignore
+// files by themselves, but not the excludes files of git. Patterns of a repository in a
+// subdirectory are anchored to it, so that all of them apply at root.
+func (o *WalkOptions) GitExcludePatterns(root string) (patterns []string, err error) {
+	if !o.GitInfoExclude && !o.GitGlobalExcludes {
+		return nil, nil
+	}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				return nil
+			}
+			return err
+		} else if !d.IsDir() {
+			return nil
+		} else if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		var ignorefiles []*ignorefile
+		err = o.addGitExcludes(&ignorefiles, path)
+		if err != nil {
+			return err
+		}
+		rel := strings.Trim(filepath.ToSlash(path[len(root):]), "/")
+		for _, igFile := range ignorefiles {
+			for _, p := range igFile.p.Patterns {
+				patterns = append(patterns, anchorPattern(p.Pattern(), rel))
+			}
+		}
+		return nil
+	})
+	return patterns, err
+}
+
+// Rewrite a gitignore pattern of an ignore file in the directory dir, which is relative to root,
+// so that it matches the same paths when it is in an ignore file in root.
+func anchorPattern(pattern, dir string) string {
+	if dir == "" {
+		return pattern
+	}
+	negate := ""
+	if strings.HasPrefix(pattern, "!") {
+		negate = "!"
+		pattern = pattern[1:]
+	}
+	dir = "/" + gitignoreEscaper.Replace(dir) + "/"
+	// A slash at the beginning or in the middle anchors a pattern to its directory.
+	// Otherwise, it matches at any depth.
+	if strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		return negate + dir + strings.TrimPrefix(pattern, "/")
+	}
+	return negate + dir + "**/" + pattern
+}
+
+// Add the ignore file at path, whose patterns are relative to dir.
+func addIgnoreIfExists(ignorefiles *[]*ignorefile, dir, path string) error {
+	if f, err := os.Stat(path); err == nil && f.Mode().Type().IsRegular() {
+		p, err := pathspec.FromFile(path)
+		if err != nil {
+			return err
+		}
+		igFile, err := newIgnorefile(p, dir, path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		*ignorefiles = append(*ignorefiles, igFile)
+	}
+	return nil
+}
+
+func newIgnorefile(p *pathspec.PathSpec, dir, path string) (*ignorefile, error) {
+	res, err := compilePatterns(p)
+	if err != nil {
+		return nil, err
+	}
+	return &ignorefile{
+		p:    p,
+		res:  res,
+		dir:  dir,
+		path: path,
+	}, nil
+}
+
+// Returns the git directory of the repository whose working tree is dir.
+// If dir is not the top-level directory of a repository, an empty string is returned.
+func findGitDir(dir string) string {
+	dotGit := filepath.Join(dir, ".git")
+	info, err := os.Lstat(dotGit)
+	if err != nil {
+		return ""
+	}
+	if info.IsDir() {
+		return dotGit
+	}
+	if !info.Mode().IsRegular() {
+		return ""
+	}
+
+	// Submodules and worktrees have a .git file pointing to the git directory.
+	content, err := os.ReadFile(dotGit)
+	if err != nil {
+		return ""
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+	if !ok {
+		return ""
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	// info/exclude of a worktree is in the common git directory.
+	if commonDir, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		c := strings.TrimSpace(string(commonDir))
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(gitDir, c)
+		}
+		return c
+	}
+	return gitDir
+}
+
+// Path of the global excludes file of git. If git is installed, `core.excludesFile` is read from its config.
+// Otherwise, or if it is not set, git's default, `$XDG_CONFIG_HOME/git/ignore`, is returned.
+var globalExcludesFile = sync.OnceValue(func() string {
+	output, err := exec.Command("git", "config", "--global", "--path", "--get", "core.excludesFile").Output()
+	if err == nil {
+		if path := string(bytes.TrimSpace(output)); path != "" {
+			return path
+		}
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "git", "ignore")
+})
@@ -0,0 +1,167 @@
+package ifile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/kopyaship/internal/config"
+)
+
+func TestGitExcludes(t *testing.T) {
+	root := t.TempDir()
+	globalExcludes := filepath.Join(t.TempDir(), "ignore")
+	for path, content := range map[string]string{
+		"repo/.git/info/exclude": "secret\n*.bak\n",
+		"repo/.gitignore":        "*.bak\n",
+		"repo/secret":            "",
+		"repo/a.tmp":             "",
+		"repo/b.bak":             "",
+		"repo/c.tmp.secret":      "",
+		"not-a-repo/a.tmp":       "",
+	} {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	require.NoError(t, os.WriteFile(globalExcludes, []byte("*.tmp\nsecret\n"), 0644))
+
+	defer func(f func() string) { globalExcludesFile = f }(globalExcludesFile)
+	globalExcludesFile = func() string { return globalExcludes }
+
+	explain := func(path string, opts *WalkOptions) *Explanation {
+		e, err := Explain(root, filepath.Join(root, path), opts)
+		require.NoError(t, err)
+		return e
+	}
+
+	// .gitignore takes precedence over .git/info/exclude, which takes precedence over the global excludes file.
+	e := explain("repo/b.bak", nil)
+	require.True(t, e.Ignored)
+	require.Equal(t, filepath.Join(root, "repo/.gitignore"), e.Ignorefile)
+
+	e = explain("repo/secret", nil)
+	require.True(t, e.Ignored)
+	require.Equal(t, filepath.Join(root, "repo/.git/info/exclude"), e.Ignorefile)
+	require.Equal(t, 1, e.Line)
+
+	e = explain("repo/a.tmp", nil)
+	require.True(t, e.Ignored)
+	require.Equal(t, globalExcludes, e.Ignorefile)
+
+	// Git excludes are only read in git repositories.
+	require.False(t, explain("not-a-repo/a.tmp", nil).Ignored)
+
+	// Sources can be disabled.
+	disabled := false
+	opts := WalkOptionsFromConfig(&config.Ignore{GitInfoExclude: &disabled, GitGlobalExcludes: &disabled})
+	require.False(t, explain("repo/secret", opts).Ignored)
+	require.False(t, explain("repo/a.tmp", opts).Ignored)
+	require.True(t, explain("repo/b.bak", opts).Ignored)
+
+	opts = WalkOptionsFromConfig(&config.Ignore{GitGlobalExcludes: &disabled})
+	require.True(t, explain("repo/secret", opts).Ignored)
+	require.False(t, explain("repo/a.tmp", opts).Ignored)
+}
+
+func TestFindGitDir(t *testing.T) {
+	root := t.TempDir()
+	require.Equal(t, "", findGitDir(root))
+
+	require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0755))
+	require.Equal(t, filepath.Join(root, ".git"), findGitDir(root))
+
+	// Worktree
+	worktree := filepath.Join(root, "worktree")
+	gitDir := filepath.Join(root, ".git", "worktrees", "worktree")
+	require.NoError(t, os.MkdirAll(gitDir, 0755))
+	require.NoError(t, os.MkdirAll(worktree, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: "+gitDir+"\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(gitDir, "commondir"), []byte("../..\n"), 0644))
+	require.Equal(t, filepath.Join(root, ".git"), findGitDir(worktree))
+}
+
+func TestIgnoreFilesAndPatterns(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		".gitignore":         "*.log\n",
+		".backupignore":      "*.bin\n",
+		"g.bin":              "",
+		"a.log":              "",
+		"b.iso":              "",
+		"keep.iso":           "",
+		"cache/data":         "",
+		"sub/c.log":          "",
+		"sub/d.iso":          "",
+		"sub/important.iso":  "",
+		"sub/nested/e.txt":   "",
+		"sub/.backupignore":  "!cache/\n",
+		"sub/cache/data":     "",
+		"sub/nested/f.cache": "",
+	} {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	opts := WalkOptionsFromConfig(&config.Ignore{
+		Files:   []string{".backupignore"},
+		Exclude: []string{"cache/", "*.cache", "*.iso"},
+		Include: []string{"keep.iso"},
+	})
+	for path, ignored := range map[string]bool{
+		// .gitignore is not read.
+		"a.log":              false,
+		"sub/c.log":          false,
+		"g.bin":              true,
+		"b.iso":              true,
+		"sub/d.iso":          true,
+		"keep.iso":           false,
+		"cache/data":         true,
+		"sub/nested/f.cache": true,
+		"sub/nested/e.txt":   false,
+		// Ignore files in subdirectories take precedence over the patterns.
+		"sub/cache/data": false,
+	} {
+		e, err := Explain(root, filepath.Join(root, path), opts)
+		require.NoError(t, err)
+		require.Equal(t, ignored, e.Ignored, path)
+	}
+
+	e, err := Explain(root, filepath.Join(root, "sub/nested/f.cache"), opts)
+	require.NoError(t, err)
+	require.Equal(t, &Explanation{
+		Path:       filepath.Join(root, "sub/nested/f.cache"),
+		Ignored:    true,
+		Ignorefile: InlinePatterns,
+		Line:       2,
+		Pattern:    "*.cache",
+	}, e)
+
+	e, err = Explain(root, filepath.Join(root, "keep.iso"), opts)
+	require.NoError(t, err)
+	require.Equal(t, InlinePatterns, e.Ignorefile)
+	require.Equal(t, "!keep.iso", e.Pattern)
+}
+
+func TestGitExcludePatterns(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".git/info/exclude":     "*.iso\n",
+		"sub/.git/info/exclude": "# comment\n/build/\nout/*.o\n!keep.iso\n",
+		"sub/main.go":           "",
+		"not-a-repo/a":          "",
+	})
+
+	opts := DefaultWalkOptions()
+	opts.GitGlobalExcludes = false
+	patterns, err := opts.GitExcludePatterns(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{"*.iso", "/sub/build/", "/sub/out/*.o", "!/sub/**/keep.iso"}, patterns)
+
+	opts.GitInfoExclude = false
+	patterns, err = opts.GitExcludePatterns(root)
+	require.NoError(t, err)
+	require.Empty(t, patterns)
+}
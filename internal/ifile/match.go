@@ -0,0 +1,81 @@
+package ifile
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	pathspec "github.com/tomruk/go-pathspec"
+)
+
+var (
+	// Suffix of the regular expression of a pattern that doesn't end with a slash.
+	// It makes the pattern match the paths under a matching directory too.
+	descendantsSuffix = fmt.Sprintf("(?:(?P<%s>/).*)?$", pathspec.DirMark)
+	// Suffix of the regular expression of a pattern that ends with a slash or `/**`.
+	dirSuffix = fmt.Sprintf("(?P<%s>/).*$", pathspec.DirMark)
+)
+
+// Compile the patterns so that they match only the path itself, as git does.
+//
+// pathspec matches the paths under a matching directory too, so that a path can be matched
+// without matching its parents. But Walk matches every directory before walking into it,
+// and doesn't walk into ignored ones. Matching the paths under a directory again makes
+// patterns like `!*/` include files, and lets a negation in an ignore file match paths
+// it doesn't mention.
+func compilePatterns(p *pathspec.PathSpec) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(p.Patterns))
+	for i, pattern := range p.Patterns {
+		expr := pattern.Regex().String()
+		ptrn := strings.TrimPrefix(pattern.Pattern(), "!")
+		switch {
+		case ptrn == "**" || ptrn == "/**":
+		case strings.HasSuffix(ptrn, "/**"):
+			// Everything inside the directory, but not the directory itself.
+			expr = strings.TrimSuffix(expr, dirSuffix) + "/.+$"
+		case strings.HasSuffix(expr, descendantsSuffix):
+			// Directories end with a slash.
+			expr = strings.TrimSuffix(expr, descendantsSuffix) + "/?$"
+		case strings.HasSuffix(expr, dirSuffix):
+			expr = strings.TrimSuffix(expr, dirSuffix) + "/$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("pattern `%s`: %v", pattern.Pattern(), err)
+		}
+		res[i] = re
+	}
+	return res, nil
+}
+
+// Returns the last pattern of the ignore file that matches rel.
+func (igFile *ignorefile) match(rel string) *pathspec.Pattern {
+	rel = filepath.ToSlash(rel)
+	rel = strings.TrimPrefix(rel, "/")
+	for j := len(igFile.res) - 1; j >= 0; j-- {
+		if igFile.res[j].MatchString(rel) {
+			return igFile.p.Patterns[j]
+		}
+	}
+	return nil
+}
+
+// Tells whether the path is ignored, and which pattern of which ignore file decides it.
+//
+// As in git, ignore files are checked starting from the innermost one, and the last matching
+// pattern of the first ignore file that has one decides: if it is negated, the path is not ignored,
+// even if an outer ignore file ignores it. Paths under ignored directories are not matched, since
+// they can't be included again.
+func match(ignorefiles []*ignorefile, path string, isDir bool) (ignored bool, igFile *ignorefile, pattern *pathspec.Pattern) {
+	for j := len(ignorefiles) - 1; j >= 0; j-- {
+		rel, ok := ignorefiles[j].relative(path, isDir)
+		if !ok {
+			continue
+		}
+		if p := ignorefiles[j].match(rel); p != nil {
+			return !p.Negate(), ignorefiles[j], p
+		}
+	}
+	return false, nil, nil
+}
@@ -0,0 +1,199 @@
+package ifile
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMatchNegation(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":         "*.log\nbuild/\n/*\n!/src\n!/docs\n",
+		"build/keep.log":     "",
+		"top":                "",
+		"src/.gitignore":     "!keep.log\n!build/\n",
+		"src/a.log":          "",
+		"src/keep.log":       "",
+		"src/build/out":      "",
+		"src/x/.gitignore":   "!a.log\n",
+		"src/x/a.log":        "",
+		"src/x/b.log":        "",
+		"docs/.gitignore":    "*\n!*/\n!*.md\n",
+		"docs/guide.md":      "",
+		"docs/guide.txt":     "",
+		"docs/api/ref.md":    "",
+		"docs/api/ref.txt":   "",
+		"docsfile/.ksignore": "*\n",
+	})
+
+	for path, ignored := range map[string]bool{
+		"top":            true,
+		"build/keep.log": true,
+		"src/a.log":      true,
+		// Negations in inner ignore files take precedence.
+		"src/keep.log":  false,
+		"src/build/out": false,
+		"src/x/a.log":   false,
+		"src/x/b.log":   true,
+		// Patterns that end with a slash don't match files under a matching directory.
+		"docs/guide.md":    false,
+		"docs/guide.txt":   true,
+		"docs/api/ref.md":  false,
+		"docs/api/ref.txt": true,
+		// .ksignore of docsfile doesn't apply to docs.
+		"docs": false,
+	} {
+		e, err := Explain(root, filepath.Join(root, path), nil)
+		require.NoError(t, err)
+		require.Equal(t, ignored, e.Ignored, path)
+	}
+}
+
+// Walk and Explain are compared against `git check-ignore` on generated trees.
+func TestGitConformance(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		root, tree := generateTree(t, r)
+		cmd := exec.Command("git", "init", "-q")
+		cmd.Dir = root
+		require.NoError(t, cmd.Run())
+		paths := treePaths(t, root)
+
+		gitIgnored := checkIgnore(t, root, paths)
+		opts := DefaultWalkOptions()
+		opts.GitGlobalExcludes = false
+
+		ifilePath := filepath.Join(t.TempDir(), "ifile")
+		i, err := New(ifilePath, ModeRestic, false, zap.NewNop())
+		require.NoError(t, err)
+		i.SetWalkOptions(opts)
+		require.NoError(t, i.Walk(root))
+		require.NoError(t, i.Close())
+		content, err := os.ReadFile(ifilePath)
+		require.NoError(t, err)
+		listed := make(map[string]bool)
+		for _, line := range strings.Split(string(content), "\n") {
+			listed[line] = true
+		}
+
+		for _, path := range paths {
+			msg := fmt.Sprintf("tree %d: %s\n%s", n, path, formatTree(tree))
+			abs := filepath.Join(root, path)
+			e, err := Explain(root, abs, opts)
+			require.NoError(t, err)
+			require.Equal(t, gitIgnored[path], e.Ignored, msg)
+
+			if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+				require.Equal(t, gitIgnored[path], !listed[filepath.ToSlash(abs)], msg)
+			}
+		}
+	}
+}
+
+var (
+	treeNames    = []string{"a", "b", "build", "src", "tmp", "keep.log", "c.log", "d.tmp", "x.txt", "doc.md"}
+	treePatterns = []string{
+		"*.log", "!keep.log", "!*.log", "build/", "/build", "!build/", "!/build", "*", "!*/", "!*.md",
+		"src/*", "!src/b", "**/tmp", "a/**", "!a/**/c.log", "/*", "!/src", "x*", "!x.txt", "**/b/",
+		"d.*", "*/", "c.log/", "!a", "b", "tmp/", "*.md", "!tmp/d.tmp", "src/**/x.txt", "**/build/*",
+	}
+)
+
+// Generates a tree of files and directories with random .gitignore files.
+func generateTree(t *testing.T, r *rand.Rand) (root string, tree map[string]string) {
+	root = t.TempDir()
+	tree = make(map[string]string)
+	var generate func(dir string, depth int)
+	generate = func(dir string, depth int) {
+		if r.Intn(2) == 0 {
+			lines := make([]string, 1+r.Intn(4))
+			for i := range lines {
+				lines[i] = treePatterns[r.Intn(len(treePatterns))]
+			}
+			tree[filepath.Join(dir, gitignore)] = strings.Join(lines, "\n") + "\n"
+		}
+		for _, i := range r.Perm(len(treeNames))[:2+r.Intn(4)] {
+			path := filepath.Join(dir, treeNames[i])
+			if depth < 3 && r.Intn(3) == 0 {
+				generate(path, depth+1)
+			} else {
+				tree[path] = ""
+			}
+		}
+	}
+	generate("", 0)
+	writeTree(t, root, tree)
+	return root, tree
+}
+
+// Returns the paths in root relative to it, except the .git directory.
+func treePaths(t *testing.T, root string) (paths []string) {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		} else if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, path)
+		paths = append(paths, filepath.ToSlash(rel))
+		return err
+	})
+	require.NoError(t, err)
+	sort.Strings(paths)
+	return paths
+}
+
+// Returns the paths that git ignores.
+func checkIgnore(t *testing.T, root string, paths []string) map[string]bool {
+	cmd := exec.Command("git", "-c", "core.excludesFile=", "check-ignore", "--no-index", "--stdin")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+	output, err := cmd.Output()
+	// Exit status is 1 if none of the paths are ignored.
+	if e, ok := err.(*exec.ExitError); !ok || e.ExitCode() != 1 {
+		require.NoError(t, err)
+	}
+
+	ignored := make(map[string]bool)
+	for _, line := range strings.Split(string(bytes.TrimSpace(output)), "\n") {
+		if line != "" {
+			ignored[line] = true
+		}
+	}
+	return ignored
+}
+
+func writeTree(t *testing.T, root string, tree map[string]string) {
+	for path, content := range tree {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func formatTree(tree map[string]string) string {
+	paths := make([]string, 0, len(tree))
+	for path, content := range tree {
+		if content != "" {
+			path += ": " + strings.ReplaceAll(strings.TrimSpace(content), "\n", ", ")
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, "\n")
+}
@@ -0,0 +1,279 @@
+package ifile
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type (
+	// Translates the patterns of ignore files to syncthing patterns.
+	//
+	// Unlike gitignore, the first matching syncthing pattern decides, and a pattern matches the paths
+	// under a matching directory too. So patterns of inner ignore files are written before the outer
+	// ones, and patterns of an ignore file are written in reverse order.
+	//
+	// Some patterns can't be expressed in syncthing's syntax, and some can be expressed only
+	// approximately (e.g. `dir/` matches files named dir too). While walking, every path is matched
+	// against both the ignore files and the translated patterns. If they don't agree, the path is
+	// written literally, before the translated patterns.
+	stPatterns struct {
+		// Both are in the order they are added, and are matched starting from the last one.
+		literals []*stPattern
+		patterns []*stPattern
+	}
+
+	stPattern struct {
+		line   string
+		re     *regexp.Regexp
+		negate bool
+		// The part of an anchored pattern before its first wildcard, without the leading slash.
+		// Empty if the pattern is not anchored.
+		prefix string
+	}
+)
+
+// Syncthing allows deleting ignored files that prevent a directory from being deleted, if
+// their patterns have the `(?d)` prefix. It is only added to patterns of files that operating
+// systems create, which are safe to delete.
+var stDeletable = map[string]bool{
+	".DS_Store":       true,
+	"._*":             true,
+	".Spotlight-V100": true,
+	".Trashes":        true,
+	"Thumbs.db":       true,
+	"ehthumbs.db":     true,
+	"desktop.ini":     true,
+}
+
+// Add the translated patterns of the ignore files, which are in the order they are read while walking root.
+func (st *stPatterns) add(ignorefiles []*ignorefile, root string) {
+	for _, igFile := range ignorefiles {
+		rel := filepath.ToSlash(igFile.dir[len(root):])
+		rel = strings.Trim(rel, "/")
+		for _, p := range igFile.p.Patterns {
+			st.patterns = append(st.patterns, translateToSyncthing(p.Pattern(), rel)...)
+		}
+	}
+}
+
+// Match the path relative to root against the translated patterns. If the result is not what the
+// ignore files decide, the path is written literally.
+func (st *stPatterns) check(rel string, isDir, ignored bool) {
+	rel = strings.Trim(filepath.ToSlash(rel), "/")
+	if st.ignored(rel) != ignored {
+		st.addLiteral(rel, ignored)
+	} else if ignored && isDir && st.negationUnder(rel) {
+		// The directory is not walked into, so it can't be known whether the negated
+		// pattern matches a path under it, which git wouldn't include.
+		st.addLiteral(rel, ignored)
+	}
+}
+
+// Tells whether a negated pattern that is matched before the pattern ignoring the
+// directory might match a path under it. Negated patterns that are matched after
+// it can't, as the pattern matches the paths under the directory too.
+func (st *stPatterns) negationUnder(dir string) bool {
+	for _, p := range st.literals {
+		if p.re.MatchString(dir) {
+			return false
+		}
+	}
+	under := dir + "/"
+	for i := len(st.patterns) - 1; i >= 0; i-- {
+		p := st.patterns[i]
+		if p.re.MatchString(dir) {
+			return false
+		}
+		// An unanchored pattern has no prefix, and might match under any directory.
+		if p.negate && (strings.HasPrefix(p.prefix, under) || strings.HasPrefix(under, p.prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *stPatterns) ignored(rel string) bool {
+	for _, list := range [][]*stPattern{st.literals, st.patterns} {
+		for i := len(list) - 1; i >= 0; i-- {
+			if list[i].re.MatchString(rel) {
+				return !list[i].negate
+			}
+		}
+	}
+	return false
+}
+
+func (st *stPatterns) addLiteral(rel string, ignored bool) {
+	line := "/" + stEscaper.Replace(rel)
+	if !ignored {
+		line = "!" + line
+	}
+	st.literals = append(st.literals, &stPattern{
+		line:   line,
+		re:     regexp.MustCompile("^" + regexp.QuoteMeta(rel) + "(?:/.*)?$"),
+		negate: !ignored,
+	})
+}
+
+// Returns the lines of the ignore file, starting from the ones that are matched first.
+// A line that is already written is left out, as it would never be matched.
+func (st *stPatterns) lines() []string {
+	lines := make([]string, 0, len(st.literals)+len(st.patterns))
+	written := make(map[string]bool, len(st.literals)+len(st.patterns))
+	for _, list := range [][]*stPattern{st.literals, st.patterns} {
+		for i := len(list) - 1; i >= 0; i-- {
+			if !written[list[i].line] {
+				written[list[i].line] = true
+				lines = append(lines, list[i].line)
+			}
+		}
+	}
+	return lines
+}
+
+var stEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`, "{", `\{`, "}", `\}`)
+
+// Translate a gitignore pattern of an ignore file in the directory dir, which is relative to root.
+// The patterns are returned in the order they should be matched. If the pattern can't be translated,
+// nil is returned.
+func translateToSyncthing(pattern, dir string) (patterns []*stPattern) {
+	negate := strings.HasPrefix(pattern, "!")
+	pattern = strings.TrimPrefix(pattern, "!")
+	// Escaping differs between platforms in syncthing, and braces are alternatives.
+	if strings.ContainsAny(pattern, `\{}`) || strings.ContainsAny(dir, `\{}*?[]`) {
+		return nil
+	}
+	// Syncthing can't match only directories. Files that are matched because of
+	// this are written literally.
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	var (
+		anchored bool
+		anyDepth bool
+	)
+	if strings.HasPrefix(pattern, "/") {
+		anchored = true
+		pattern = pattern[1:]
+	}
+	for !anchored && strings.HasPrefix(pattern, "**/") {
+		anyDepth = true
+		pattern = pattern[3:]
+	}
+	if pattern == "" {
+		return nil
+	}
+	if strings.Contains(pattern, "/") {
+		// A slash in the middle anchors a pattern in gitignore, unless it begins with `**/`.
+		anchored = !anyDepth
+	} else if !anchored {
+		anyDepth = true
+	}
+
+	// `a/**/b` matches `a/b` too in gitignore, but not in syncthing.
+	bodies := []string{pattern}
+	switch strings.Count(pattern, "/**/") {
+	case 0:
+	case 1:
+		bodies = append(bodies, strings.Replace(pattern, "/**/", "/", 1))
+	default:
+		return nil
+	}
+
+	prefix := "/"
+	if dir != "" {
+		prefix += dir + "/"
+	}
+	for _, body := range bodies {
+		var globs []string
+		switch {
+		case anyDepth && dir == "":
+			globs = []string{body}
+		case anyDepth:
+			globs = []string{prefix + body, prefix + "**/" + body}
+		default:
+			globs = []string{prefix + body}
+		}
+		for _, glob := range globs {
+			p, ok := newStPattern(glob, negate)
+			if !ok {
+				return nil
+			}
+			patterns = append(patterns, p)
+		}
+	}
+	// Patterns are matched starting from the last one.
+	for i, j := 0, len(patterns)-1; i < j; i, j = i+1, j-1 {
+		patterns[i], patterns[j] = patterns[j], patterns[i]
+	}
+	return patterns
+}
+
+func newStPattern(glob string, negate bool) (*stPattern, bool) {
+	// Prefixes like (?i) and #include have special meanings.
+	if strings.HasPrefix(glob, "(?") || strings.HasPrefix(glob, "#") || strings.HasPrefix(glob, "//") {
+		return nil, false
+	}
+
+	var (
+		expr   strings.Builder
+		body   = glob
+		prefix string
+	)
+	if strings.HasPrefix(glob, "/") {
+		expr.WriteString("^")
+		body = glob[1:]
+		prefix = body
+		if i := strings.IndexAny(body, "*?["); i != -1 {
+			prefix = body[:i]
+		}
+	} else {
+		// Patterns without a leading slash match in any directory.
+		expr.WriteString("^(?:.*/)?")
+	}
+	for _, segment := range strings.Split(body, "/") {
+		if strings.Contains(segment, "**") && segment != "**" {
+			return nil, false
+		}
+	}
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; c {
+		case '*':
+			if i+1 < len(body) && body[i+1] == '*' {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(body[i+1:], ']')
+			if end == -1 {
+				return nil, false
+			}
+			class := body[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("(?:/.*)?$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, false
+	}
+
+	line := glob
+	if negate {
+		line = "!" + line
+	} else if stDeletable[path.Base(glob)] {
+		line = "(?d)" + line
+	}
+	return &stPattern{line: line, re: re, negate: negate, prefix: prefix}, true
+}
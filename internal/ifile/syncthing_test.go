@@ -0,0 +1,123 @@
+package ifile
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTranslateToSyncthing(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		dir     string
+		lines   []string
+	}{
+		{"*.log", "", []string{"*.log"}},
+		{"*.log", "a/b", []string{"/a/b/**/*.log", "/a/b/*.log"}},
+		{"!keep.log", "", []string{"!keep.log"}},
+		{"/build", "", []string{"/build"}},
+		{"/build", "a", []string{"/a/build"}},
+		{"node_modules/", "", []string{"node_modules"}},
+		{"src/gen", "a", []string{"/a/src/gen"}},
+		{"**/tmp", "", []string{"tmp"}},
+		{"**/a/tmp", "", []string{"a/tmp"}},
+		{"a/**", "", []string{"/a/**"}},
+		{"a/**/b", "", []string{"/a/b", "/a/**/b"}},
+		{".DS_Store", "", []string{"(?d).DS_Store"}},
+		{"!.DS_Store", "", []string{"!.DS_Store"}},
+		{"[!a]?.txt", "", []string{"[!a]?.txt"}},
+		// Can't be translated.
+		{`\#notes`, "", nil},
+		{"{a,b}", "", nil},
+		{"a/**/b/**/c", "", nil},
+		{"a**b/c", "", nil},
+		{"(?i)x", "", nil},
+		{"*.log", "[dir]", nil},
+	} {
+		var lines []string
+		for _, p := range translateToSyncthing(tc.pattern, tc.dir) {
+			lines = append(lines, p.line)
+		}
+		require.Equal(t, tc.lines, lines, "%s in %s", tc.pattern, tc.dir)
+	}
+}
+
+func TestSyncthingPatterns(t *testing.T) {
+	root := t.TempDir()
+	tree := map[string]string{
+		".gitignore":     "node_modules/\n*.log\n!keep.log\n.DS_Store\n",
+		"a.log":          "",
+		"keep.log":       "",
+		".DS_Store":      "",
+		"sub/.gitignore": "/tmp\n",
+		"sub/b":          "",
+		"sub/tmp/f":      "",
+	}
+	for i := 0; i < 100; i++ {
+		tree[fmt.Sprintf("node_modules/%d/index.js", i)] = ""
+	}
+	tree["node_modules/x/keep.log"] = ""
+	writeTree(t, root, tree)
+
+	lines := syncthingPatterns(t, root)
+	require.Equal(t, []string{
+		// !keep.log comes before node_modules, but git doesn't include paths under ignored directories.
+		// /sub/tmp comes before it, so it isn't written literally.
+		"/node_modules",
+		"/sub/tmp",
+		"(?d).DS_Store",
+		"!keep.log",
+		"*.log",
+		"node_modules",
+	}, lines)
+}
+
+// Translated patterns are compared with Explain on generated trees, including the paths under ignored directories.
+func TestSyncthingPatternsConformance(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for n := 0; n < 100; n++ {
+		root, tree := generateTree(t, r)
+
+		st := &stPatterns{}
+		for _, line := range syncthingPatterns(t, root) {
+			negate := strings.HasPrefix(line, "!")
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "!"), "(?d)")
+			p, ok := newStPattern(line, negate)
+			require.True(t, ok, line)
+			st.literals = append([]*stPattern{p}, st.literals...)
+		}
+
+		for _, path := range treePaths(t, root) {
+			e, err := Explain(root, filepath.Join(root, path), nil)
+			require.NoError(t, err)
+			require.Equal(t, e.Ignored, st.ignored(path), "tree %d: %s\n%s", n, path, formatTree(tree))
+		}
+	}
+}
+
+// Returns the lines that are generated in ModeSyncthingPatterns.
+func syncthingPatterns(t *testing.T, root string) []string {
+	ifilePath := filepath.Join(t.TempDir(), ".stignore")
+	i, err := New(ifilePath, ModeSyncthingPatterns, false, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, i.Walk(root))
+	require.NoError(t, i.Close())
+
+	content, err := os.ReadFile(ifilePath)
+	require.NoError(t, err)
+	lines := strings.Split(string(content), "\n")
+	require.Equal(t, beginIndicator, lines[1])
+	for j, line := range lines {
+		if line == endIndicator {
+			return lines[2:j]
+		}
+	}
+	t.Fatal("end indicator not found")
+	return nil
+}
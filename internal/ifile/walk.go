@@ -1,6 +1,7 @@
 package ifile
 
 import (
+	"bufio"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -8,7 +9,6 @@ import (
 	"strings"
 	"syscall"
 
-	pathspec "github.com/tomruk/go-pathspec"
 	"github.com/tomruk/kopyaship/internal/utils"
 )
 
@@ -22,129 +22,214 @@ const (
 	runningOnWindows = runtime.GOOS == "windows"
 )
 
+type (
+	// State of a single Walk. Entries are written to a part file of the ifile as soon as they are
+	// visited, in the lexical order filepath.WalkDir visits them. Only the directories that are
+	// being walked, and their ignore files, are kept in memory.
+	walker struct {
+		*Ifile
+		root        string
+		w           *bufio.Writer
+		ignorefiles []*ignorefile
+		// Directories from the root (excluded) to the one that is being walked.
+		dirs []*walkedDir
+		st   *stPatterns
+	}
+
+	walkedDir struct {
+		entry *entry
+		path  string
+		// Length of ignorefiles before the ignore files of the directory are added.
+		ignorefiles int
+		// Whether the directory has an entry, ignored or not. Restic lists only the empty
+		// directories, since the included paths under a directory are enough for it to be backed
+		// up, and listing a directory backs up everything under it, including the ignored paths.
+		hasEntries bool
+	}
+)
+
 func (i *Ifile) Walk(root string) error {
-	ignorefiles := make([]*ignorefile, 0, 100)
-	entries := make(entries, 0, 10000)
-	err := addIgnoreIfExists(&ignorefiles, root)
+	// Only the file that replaces the ifile has to be in its directory. Parts are created
+	// in the temporary directory, so that they don't show up in the walked directories.
+	f, err := os.CreateTemp("", "kopyaship_ifile_*.part")
 	if err != nil {
 		return err
 	}
+	p := &part{root: root, path: f.Name()}
 
-	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			if e, ok := err.(*fs.PathError); ok {
-				if e, ok := e.Err.(syscall.Errno); ok && e.Is(fs.ErrPermission) {
-					return nil
-				}
-			}
-			return err
-		} else if path == root {
-			return nil
-		}
+	w := &walker{
+		Ifile:       i,
+		root:        root,
+		w:           bufio.NewWriterSize(f, 64*1024),
+		ignorefiles: make([]*ignorefile, 0, 100),
+	}
+	err = w.walk()
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(p.path)
+		return err
+	}
+
+	i.partsMu.Lock()
+	defer i.partsMu.Unlock()
+	i.parts = append(i.parts, p)
+	return nil
+}
+
+func (w *walker) walk() error {
+	err := w.opts.addRoot(&w.ignorefiles, w.root)
+	if err != nil {
+		return err
+	}
+	if w.mode == ModeSyncthingPatterns {
+		w.st = &stPatterns{}
+		w.st.add(w.ignorefiles, w.root)
+	}
 
-		t := d.Type()
-		if t.IsDir() {
-			err = addIgnoreIfExists(&ignorefiles, path)
+	err = filepath.WalkDir(w.root, w.visit)
+	if err != nil {
+		return err
+	}
+	err = w.leave("")
+	if err != nil {
+		return err
+	}
+
+	if w.st != nil {
+		for _, line := range w.st.lines() {
+			_, err = w.w.WriteString(line + "\n")
 			if err != nil {
 				return err
 			}
 		}
+	}
+	return nil
+}
 
-		anyMatches := false
-		for j := len(ignorefiles) - 1; j >= 0; j-- {
-			igFile := ignorefiles[j]
-
-			if strings.HasPrefix(path, igFile.dir) {
-				trimmed := path[len(igFile.dir):]
-				if t.IsDir() && !strings.HasSuffix(trimmed, "/") {
-					trimmed += "/"
-				}
-				match := igFile.p.Match(trimmed)
-
-				if i.mode == ModeRestic && match {
-					if t.IsDir() {
-						return filepath.SkipDir
-					}
-					return nil
-				}
-				if i.mode == ModeSyncthing && match {
-					anyMatches = true
-					path = path[len(root):]
-					break
-				}
-			}
-		}
-
-		if i.mode == ModeSyncthing && !anyMatches {
-			return nil
-		} else if i.mode == ModeSyncthing {
-			if runningOnWindows {
-				path = utils.StripDriveLetter(path)
+func (w *walker) visit(path string, d fs.DirEntry, err error) error {
+	if err != nil {
+		if e, ok := err.(*fs.PathError); ok {
+			if e, ok := e.Err.(syscall.Errno); ok && e.Is(fs.ErrPermission) {
+				return nil
 			}
 		}
-
-		entries = append(entries, &entry{
-			path:  path,
-			isDir: t.IsDir(),
-		})
+		return err
+	} else if path == w.root {
+		return nil
+	} else if isOwnFile(path) {
+		// The previous version of the ifile, or the ifile that is being
+		// written, if the ifile is in the walked directory.
 		return nil
-	})
+	}
+
+	err = w.leave(path)
 	if err != nil {
 		return err
 	}
-
-	growLen := 0
-	for _, entry := range entries {
-		growLen += entry.Len()
+	if len(w.dirs) != 0 {
+		w.dirs[len(w.dirs)-1].hasEntries = true
 	}
 
-	i.bufMu.Lock()
-	defer i.bufMu.Unlock()
-	i.buf.Grow(growLen)
-
-outer:
-	for _, entry := range entries {
-		// If the entry is a directory, check if it contains a children.
-		// If it's empty (doesn't have a children), add it to the list.
-		if entry.isDir {
-			for _, _entry := range entries {
-				if strings.HasPrefix(_entry.path, entry.path) && strings.ContainsRune(strings.TrimPrefix(_entry.path, entry.path), os.PathSeparator) {
-					continue outer
-				}
-			}
-		}
-
-		_, err = i.buf.WriteString(entry.String())
+	isDir := d.Type().IsDir()
+	n := len(w.ignorefiles)
+	if isDir {
+		err = w.opts.addIgnorefiles(&w.ignorefiles, path)
 		if err != nil {
 			return err
 		}
+		if w.st != nil {
+			w.st.add(w.ignorefiles[n:], w.root)
+		}
 	}
-	return err
-}
 
-func addIgnoreIfExists(ignorefiles *[]*ignorefile, dir string) error {
-	path := filepath.Join(dir, gitignore)
-	if f, err := os.Stat(path); err == nil && f.Mode().Type().IsRegular() {
-		p, err := pathspec.FromFile(path)
+	// Restic reads included paths, while the others read excluded ones.
+	ignored, _, _ := match(w.ignorefiles, path, isDir)
+	var e *entry
+	switch {
+	case w.st != nil:
+		w.st.check(path[len(w.root):], isDir, ignored)
+	case w.mode == ModeRestic && !ignored:
+		e = &entry{path: path, isDir: isDir}
+		if !isDir {
+			_, err = w.w.WriteString(e.line(w.mode))
+			if err != nil {
+				return err
+			}
+		}
+	case w.mode != ModeRestic && ignored:
+		e = &entry{path: path, isDir: isDir}
+		if w.mode.relative() {
+			e.path = path[len(w.root):]
+			if runningOnWindows {
+				e.path = utils.StripDriveLetter(e.path)
+			}
+		}
+		_, err = w.w.WriteString(e.line(w.mode))
 		if err != nil {
 			return err
 		}
-		*ignorefiles = append(*ignorefiles, &ignorefile{
-			p:   p,
-			dir: dir,
-		})
 	}
 
-	path = filepath.Join(dir, ksignore)
-	if f, err := os.Stat(path); err == nil && f.Mode().Type().IsRegular() {
-		p, err := pathspec.FromFile(path)
-		if err != nil {
-			return err
+	if !isDir {
+		return nil
+	} else if ignored {
+		// Paths under an ignored directory are ignored too. They don't need to be listed.
+		w.ignorefiles = w.ignorefiles[:n]
+		return filepath.SkipDir
+	}
+	dir := &walkedDir{path: path, ignorefiles: n}
+	if w.mode == ModeRestic {
+		// Written when the directory is left, if it turns out to be empty.
+		dir.entry = e
+	}
+	w.dirs = append(w.dirs, dir)
+	return nil
+}
+
+// Pop the directories that the path is not under, as filepath.WalkDir has already walked them.
+// Their ignore files don't apply to the remaining paths. If path is empty, all of them are popped.
+func (w *walker) leave(path string) error {
+	for len(w.dirs) != 0 {
+		dir := w.dirs[len(w.dirs)-1]
+		if path != "" && isUnder(path, dir.path) {
+			break
+		}
+		w.dirs = w.dirs[:len(w.dirs)-1]
+		w.ignorefiles = w.ignorefiles[:dir.ignorefiles]
+		if dir.entry != nil && !dir.hasEntries {
+			_, err := w.w.WriteString(dir.entry.line(w.mode))
+			if err != nil {
+				return err
+			}
 		}
-		*ignorefiles = append(*ignorefiles, &ignorefile{
-			p:   p,
-			dir: dir,
-		})
 	}
 	return nil
 }
+
+// Tells whether path is under the directory dir.
+func isUnder(path, dir string) bool {
+	return len(path) > len(dir) && strings.HasPrefix(path, dir) &&
+		(os.IsPathSeparator(path[len(dir)]) || os.IsPathSeparator(dir[len(dir)-1]))
+}
+
+// Returns the path relative to the directory of the ignore file, as it is matched against
+// its patterns. Directories end with `/`. ok is false if the path is not in the directory.
+func (igFile *ignorefile) relative(path string, isDir bool) (rel string, ok bool) {
+	if !strings.HasPrefix(path, igFile.dir) {
+		return "", false
+	}
+	rel = path[len(igFile.dir):]
+	// Siblings of the directory that start with its name.
+	if rel != "" && !os.IsPathSeparator(rel[0]) && !os.IsPathSeparator(igFile.dir[len(igFile.dir)-1]) {
+		return "", false
+	}
+	if isDir && !strings.HasSuffix(rel, "/") {
+		rel += "/"
+	}
+	return rel, true
+}
@@ -1,6 +1,7 @@
 package ifile
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -13,6 +14,7 @@ import (
 
 func TestSyncthingWalkInCurrentProject(t *testing.T) {
 	testIfile := testIfile("syncthing_walk_in_current_project")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	i, err := New(testIfile, ModeSyncthing, true, zap.NewNop())
 	if err != nil {
@@ -43,6 +45,7 @@ func TestSyncthingWalkInCurrentProject(t *testing.T) {
 // Ensure the root path doesn't appear in ifile.
 func TestSyncthingWalkNoRootMatchesInCurrentProject(t *testing.T) {
 	testIfile := testIfile("syncthing_walk_no_root_matches_in_current_project")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	i, err := New(testIfile, ModeSyncthing, true, zap.NewNop())
 	if err != nil {
@@ -71,6 +74,7 @@ func TestSyncthingWalkNoRootMatchesInCurrentProject(t *testing.T) {
 
 func TestSyncthingWalkInCurrentProjectAppend(t *testing.T) {
 	testIfile := testIfile("syncthing_walk_in_current_project_append")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	i, err := New(testIfile, ModeSyncthing, true, zap.NewNop())
 	if err != nil {
@@ -123,6 +127,7 @@ func TestSyncthingWalkInCurrentProjectAppend(t *testing.T) {
 
 func TestResticWalkInCurrentProject(t *testing.T) {
 	testIfile := testIfile("restic_walk_in_current_project")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	i, err := New(testIfile, ModeRestic, false, zap.NewNop())
 	if err != nil {
@@ -146,3 +151,81 @@ func TestResticWalkInCurrentProject(t *testing.T) {
 		require.NotContains(t, line, "test_file")
 	}
 }
+
+// Restic lists only the directories that don't have any entries. Directories whose
+// entries are all ignored are not listed, as restic would back up the ignored entries.
+func TestResticWalkEmptyDirectories(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":     "*.log\nbuild/\n",
+		"ab/ignored.log": "",
+		"b/x":            "",
+		"c/build/out":    "",
+		// Left behind by a previous ifile in the walked directory.
+		"ifile" + backupSuffix: "",
+	})
+	for _, dir := range []string{"a", "b/c", "b/d/e"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+
+	ifilePath := filepath.Join(t.TempDir(), "ifile")
+	i, err := New(ifilePath, ModeRestic, false, zap.NewNop())
+	require.NoError(t, err)
+	opts := DefaultWalkOptions()
+	opts.GitGlobalExcludes = false
+	i.SetWalkOptions(opts)
+	require.NoError(t, i.Walk(root))
+	require.NoError(t, i.Close())
+
+	content, err := os.ReadFile(ifilePath)
+	require.NoError(t, err)
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, filepath.ToSlash(root)) {
+			lines = append(lines, strings.TrimPrefix(line, filepath.ToSlash(root)))
+		}
+	}
+	require.Equal(t, []string{"/.gitignore", "/a", "/b/c", "/b/d/e", "/b/x"}, lines)
+}
+
+func BenchmarkWalk(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		root := generateBenchmarkTree(b, n)
+		for _, mode := range []Mode{ModeRestic, ModeSyncthing} {
+			b.Run(fmt.Sprintf("%s/paths=%d", mode.String(), n), func(b *testing.B) {
+				ifilePath := filepath.Join(b.TempDir(), "ifile")
+				opts := DefaultWalkOptions()
+				opts.GitGlobalExcludes = false
+				b.ResetTimer()
+				for j := 0; j < b.N; j++ {
+					i, err := New(ifilePath, mode, false, zap.NewNop())
+					require.NoError(b, err)
+					i.SetWalkOptions(opts)
+					require.NoError(b, i.Walk(root))
+					require.NoError(b, i.Close())
+				}
+				// Should stay about the same as the number of paths grows.
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/path")
+			})
+		}
+	}
+}
+
+// Generates a tree of about n paths. Every directory has an ignore file, files that are
+// ignored, and an empty directory, which restic lists.
+func generateBenchmarkTree(b *testing.B, n int) string {
+	root := b.TempDir()
+	for d := 0; d < n/10; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("%03d", d%100), fmt.Sprintf("%d", d))
+		require.NoError(b, os.MkdirAll(filepath.Join(dir, "empty"), 0755))
+		require.NoError(b, os.WriteFile(filepath.Join(dir, gitignore), []byte("*.log\n/build/\n"), 0644))
+		for f := 0; f < 7; f++ {
+			name := fmt.Sprintf("file%d.txt", f)
+			if f%3 == 0 {
+				name = fmt.Sprintf("file%d.log", f)
+			}
+			require.NoError(b, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+		}
+	}
+	return root
+}
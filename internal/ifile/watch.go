@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,7 +31,9 @@ type (
 		ifile    string
 		mode     Mode
 
-		walk func() error
+		walk        func() error
+		onWalk      atomic.Value
+		walkOptions atomic.Value
 
 		testEventChanSender atomic.Value
 	}
@@ -99,7 +102,12 @@ func NewWatchJob(ifile, scanPath string, mode Mode, runPreHooks, runPostHooks fu
 			return err
 		}
 		defer i.Close()
+		i.SetWalkOptions(j.options())
+		start := time.Now()
 		walkErr := i.Walk(j.scanPath)
+		if onWalk, ok := j.onWalk.Load().(func(start time.Time, err error)); ok {
+			onWalk(start, walkErr)
+		}
 		err = runPostHooks()
 		if err != nil {
 			j.logS.Errorf("One of the posthooks has failed: %v", err)
@@ -109,6 +117,19 @@ func NewWatchJob(ifile, scanPath string, mode Mode, runPreHooks, runPostHooks fu
 	return j
 }
 
+// OnWalk sets a function that is called after every walk with its start time and result.
+func (j *WatchJob) OnWalk(f func(start time.Time, err error)) { j.onWalk.Store(f) }
+
+// SetWalkOptions sets the sources of ignore patterns. By default, DefaultWalkOptions is used.
+func (j *WatchJob) SetWalkOptions(o *WalkOptions) { j.walkOptions.Store(o) }
+
+func (j *WatchJob) options() *WalkOptions {
+	if o, ok := j.walkOptions.Load().(*WalkOptions); ok {
+		return o
+	}
+	return DefaultWalkOptions()
+}
+
 func (j *WatchJob) ScanPath() string { return j.scanPath }
 
 func (j *WatchJob) Ifile() string { return j.ifile }
@@ -148,7 +169,7 @@ func (j *WatchJob) Run() (err error) {
 
 outer:
 	for {
-		watcher, eventChan, err = watch(j.scanPath)
+		watcher, eventChan, err = watch(j.scanPath, j.ifile, j.options().Ignorefiles)
 		if err != nil {
 			j.logError(err)
 			j.sleepBeforeRetry(1)
@@ -236,7 +257,7 @@ func (j *WatchJob) Shutdown() error {
 	return nil
 }
 
-func watch(root string) (watcher *fsnotify.Watcher, eventChan chan string, err error) {
+func watch(root, ifile string, ignorefiles []string) (watcher *fsnotify.Watcher, eventChan chan string, err error) {
 	watcher, err = fsnotify.NewWatcher()
 	if err != nil {
 		return
@@ -248,6 +269,9 @@ func watch(root string) (watcher *fsnotify.Watcher, eventChan chan string, err e
 			event, ok := <-watcher.Events
 			if !ok {
 				return
+			} else if event.Name == ifile || isOwnFile(event.Name) {
+				// Written while generating the ifile. Walking again would only generate the same ifile.
+				continue
 			}
 			if event.Has(fsnotify.Create) {
 				if st, err := os.Stat(event.Name); err == nil {
@@ -257,8 +281,7 @@ func watch(root string) (watcher *fsnotify.Watcher, eventChan chan string, err e
 				}
 				eventChan <- event.Name
 			} else if event.Has(fsnotify.Write) {
-				base := filepath.Base(event.Name)
-				if base == gitignore || base == ksignore {
+				if slices.Contains(ignorefiles, filepath.Base(event.Name)) {
 					eventChan <- event.Name
 				}
 			}
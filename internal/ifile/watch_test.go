@@ -26,6 +26,7 @@ var scanPath = func() string {
 func TestWatch(t *testing.T) {
 	const testTxtfile = "test_txtfile_watch"
 	testIfile := testIfile("watch")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	os.Remove(testTxtfile)
 
@@ -93,6 +94,7 @@ func TestWatch(t *testing.T) {
 func TestWatchIgnore(t *testing.T) {
 	const testTxtfile = "test_txtfile_watch_ignore"
 	testIfile := testIfile("watch_ignore")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	os.Remove(testTxtfile)
 	os.Remove(".gitignore")
@@ -173,6 +175,7 @@ func TestWatchIgnoreNewlyCreatedDir(t *testing.T) {
 		testTxtfile = "test_txtfile_watch_ignore_newly_created_dir"
 	)
 	testIfile := testIfile("watch_ignore_newly_created_dir")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	os.RemoveAll(testDir)
 	os.Remove(".gitignore")
@@ -255,6 +258,7 @@ func TestWatchFail(t *testing.T) {
 		testTxtfile2 = "test_txtfile_watchfail_2"
 	)
 	testIfile := testIfile("watch_fail")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 	os.Remove(testTxtfile1)
 	os.Remove(testTxtfile2)
@@ -405,6 +409,7 @@ func TestWatchFail(t *testing.T) {
 
 func TestWatchFailImmediately(t *testing.T) {
 	testIfile := testIfile("watch_fail_immediately")
+	defer os.Remove(testIfile + backupSuffix)
 	os.Remove(testIfile)
 
 	runHooks := func() error { return fmt.Errorf("nothing") } // Just so that coverage is triggered.
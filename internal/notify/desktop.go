@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// Desktop shows the notification on the desktop with `notify-send`, which sends it over D-Bus.
+// If kopyaship runs as a system service, the session bus of the user might not be reachable.
+type Desktop struct {
+	urgency string
+}
+
+func NewDesktop(urgency string) *Desktop {
+	return &Desktop{urgency: urgency}
+}
+
+func (d *Desktop) Notify(ctx context.Context, n *Notification) error {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+	args := []string{"--app-name", "kopyaship"}
+	urgency := d.urgency
+	if urgency == "" && n.Event != EventBackupSuccess {
+		urgency = "critical"
+	}
+	if urgency != "" {
+		args = append(args, "--urgency", urgency)
+	}
+	args = append(args, n.Title, n.Message)
+
+	output, err := exec.CommandContext(ctx, "notify-send", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("notify-send: %v: %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Gotify pushes the notification to a Gotify server.
+type Gotify struct {
+	url      string
+	token    string
+	priority int
+}
+
+func NewGotify(url, token string, priority int) *Gotify {
+	return &Gotify{url: strings.TrimSuffix(url, "/"), token: token, priority: priority}
+}
+
+func (g *Gotify) Notify(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(map[string]any{
+		"title":    n.Title,
+		"message":  n.Message,
+		"priority": g.priority,
+	})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"X-Gotify-Key": g.token,
+	}
+	return post(ctx, g.url+"/message", body, headers)
+}
@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+	"github.com/tomruk/kopyaship/internal/config"
+	"github.com/tomruk/kopyaship/internal/utils"
+)
+
+type Event string
+
+const (
+	EventBackupSuccess   Event = "backup_success"
+	EventBackupFailure   Event = "backup_failure"
+	EventWatchJobFailure Event = "watch_job_failure"
+	EventStaleBackup     Event = "stale_backup"
+)
+
+// Events that trigger a notifier if its `events` are not set.
+var defaultEvents = []Event{EventBackupFailure, EventWatchJobFailure, EventStaleBackup}
+
+// Timeout of a single request to a notification service.
+const timeout = 30 * time.Second
+
+type (
+	Notification struct {
+		Event Event `json:"event"`
+		// Name of the backup, or path of the ifile.
+		Name     string    `json:"name"`
+		Hostname string    `json:"hostname"`
+		Time     time.Time `json:"time"`
+		Title    string    `json:"title"`
+		Message  string    `json:"message"`
+		Error    string    `json:"error,omitempty"`
+		// Only set for backup_success.
+		Result *provider.BackupResult `json:"result,omitempty"`
+	}
+
+	Notifier interface {
+		Notify(ctx context.Context, n *Notification) error
+	}
+
+	// Notifiers sends notifications to the notifiers subscribed to their event.
+	Notifiers struct {
+		subscriptions []*subscription
+	}
+
+	subscription struct {
+		Notifier
+		events map[Event]bool
+	}
+)
+
+func FromConfig(cfg *config.Notifications) (*Notifiers, error) {
+	n := &Notifiers{}
+	for i, c := range cfg.Notify {
+		var notifier Notifier
+		switch {
+		case c.Webhook != nil:
+			notifier = NewWebhook(c.Webhook.URL, c.Webhook.Headers)
+		case c.Ntfy != nil:
+			notifier = NewNtfy(c.Ntfy.URL, c.Ntfy.Token, c.Ntfy.Priority)
+		case c.Gotify != nil:
+			notifier = NewGotify(c.Gotify.URL, c.Gotify.Token, c.Gotify.Priority)
+		case c.SMTP != nil:
+			notifier = NewSMTP(c.SMTP.Host, c.SMTP.Port, c.SMTP.Username, c.SMTP.Password, c.SMTP.From, c.SMTP.To)
+		case c.Desktop != nil:
+			notifier = NewDesktop(c.Desktop.Urgency)
+		default:
+			return nil, fmt.Errorf("notifier %d: no notifier is set", i+1)
+		}
+
+		s := &subscription{Notifier: notifier, events: make(map[Event]bool)}
+		for _, event := range c.Events {
+			switch e := Event(event); e {
+			case EventBackupSuccess, EventBackupFailure, EventWatchJobFailure, EventStaleBackup:
+				s.events[e] = true
+			default:
+				return nil, fmt.Errorf("notifier %d: invalid event `%s`. valid events are: %s, %s, %s, %s",
+					i+1, event, EventBackupSuccess, EventBackupFailure, EventWatchJobFailure, EventStaleBackup)
+			}
+		}
+		if len(c.Events) == 0 {
+			for _, e := range defaultEvents {
+				s.events[e] = true
+			}
+		}
+		n.subscriptions = append(n.subscriptions, s)
+	}
+	return n, nil
+}
+
+// Notify sends the notification to every notifier subscribed to its event.
+// A failing notifier doesn't prevent others from being notified.
+func (n *Notifiers) Notify(ctx context.Context, notification *Notification) error {
+	if n == nil {
+		return nil
+	}
+	var errs []error
+	for _, s := range n.subscriptions {
+		if !s.events[notification.Event] {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		err := s.Notify(ctx, notification)
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func newNotification(event Event, name, title, message string, err error) *Notification {
+	hostname, _ := os.Hostname()
+	n := &Notification{
+		Event:    event,
+		Name:     name,
+		Hostname: hostname,
+		Time:     time.Now(),
+		Title:    title,
+		Message:  message,
+	}
+	if err != nil {
+		n.Error = err.Error()
+	}
+	return n
+}
+
+func BackupSucceeded(name string, result *provider.BackupResult) *Notification {
+	message := fmt.Sprintf("Backup `%s` is successful.", name)
+	if result != nil {
+		message = fmt.Sprintf("Backup `%s` is successful. %d files processed, %s added in %s.",
+			name, result.FilesProcessed, utils.FormatBytes(result.DataAdded), result.Duration.Round(time.Second))
+	}
+	n := newNotification(EventBackupSuccess, name, fmt.Sprintf("Backup %s succeeded", name), message, nil)
+	n.Result = result
+	return n
+}
+
+func BackupFailed(name string, err error) *Notification {
+	return newNotification(EventBackupFailure, name,
+		fmt.Sprintf("Backup %s failed", name),
+		fmt.Sprintf("Backup `%s` failed: %v", name, err),
+		err,
+	)
+}
+
+func WatchJobFailed(ifile string, err error) *Notification {
+	return newNotification(EventWatchJobFailure, ifile,
+		"Watch job failed",
+		fmt.Sprintf("Watch job of ifile `%s` failed: %v", ifile, err),
+		err,
+	)
+}
+
+func BackupStale(name string, lastSuccess time.Time) *Notification {
+	return newNotification(EventStaleBackup, name,
+		fmt.Sprintf("Backup %s is stale", name),
+		fmt.Sprintf("Backup `%s` hasn't succeeded since %s.", name, lastSuccess.Format(time.DateTime)),
+		nil,
+	)
+}
+
+var httpClient = &http.Client{Timeout: timeout}
+
+func post(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: status: %d, error message: %s", url, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
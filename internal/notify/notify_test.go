@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+	"github.com/tomruk/kopyaship/internal/config"
+)
+
+type request struct {
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+func newServer(t *testing.T, status int) (url string, requests chan *request) {
+	requests = make(chan *request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		requests <- &request{path: r.URL.Path, headers: r.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, requests
+}
+
+func TestWebhook(t *testing.T) {
+	url, requests := newServer(t, http.StatusOK)
+	w := NewWebhook(url+"/hook", map[string]string{"X-Token": "secret"})
+
+	err := w.Notify(context.Background(), BackupSucceeded("home", &provider.BackupResult{SnapshotID: "abc", FilesProcessed: 3}))
+	require.NoError(t, err)
+
+	r := <-requests
+	require.Equal(t, "/hook", r.path)
+	require.Equal(t, "secret", r.headers.Get("X-Token"))
+	require.Equal(t, "application/json", r.headers.Get("Content-Type"))
+
+	n := &Notification{}
+	require.NoError(t, json.Unmarshal(r.body, n))
+	require.Equal(t, EventBackupSuccess, n.Event)
+	require.Equal(t, "home", n.Name)
+	require.Equal(t, "abc", n.Result.SnapshotID)
+	require.Equal(t, uint64(3), n.Result.FilesProcessed)
+}
+
+func TestNtfy(t *testing.T) {
+	url, requests := newServer(t, http.StatusOK)
+	nt := NewNtfy(url+"/backups", "tk", "high")
+
+	err := nt.Notify(context.Background(), BackupFailed("home", errors.New("repository is locked")))
+	require.NoError(t, err)
+
+	r := <-requests
+	require.Equal(t, "/backups", r.path)
+	require.Equal(t, "Backup home failed", r.headers.Get("Title"))
+	require.Equal(t, "high", r.headers.Get("Priority"))
+	require.Equal(t, "Bearer tk", r.headers.Get("Authorization"))
+	require.Contains(t, string(r.body), "repository is locked")
+}
+
+func TestGotify(t *testing.T) {
+	url, requests := newServer(t, http.StatusOK)
+	g := NewGotify(url+"/", "tk", 8)
+
+	err := g.Notify(context.Background(), WatchJobFailed("/photos/.stignore", errors.New("permission denied")))
+	require.NoError(t, err)
+
+	r := <-requests
+	require.Equal(t, "/message", r.path)
+	require.Equal(t, "tk", r.headers.Get("X-Gotify-Key"))
+
+	var body struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+	}
+	require.NoError(t, json.Unmarshal(r.body, &body))
+	require.Equal(t, "Watch job failed", body.Title)
+	require.Contains(t, body.Message, "/photos/.stignore")
+	require.Equal(t, 8, body.Priority)
+}
+
+func TestNotifyErrorStatus(t *testing.T) {
+	url, _ := newServer(t, http.StatusUnauthorized)
+	err := NewWebhook(url, nil).Notify(context.Background(), BackupFailed("home", errors.New("failed")))
+	require.ErrorContains(t, err, "status: 401")
+}
+
+func TestNotifiersEvents(t *testing.T) {
+	defaultURL, defaultRequests := newServer(t, http.StatusOK)
+	successURL, successRequests := newServer(t, http.StatusOK)
+
+	n, err := FromConfig(&config.Notifications{
+		Notify: []*config.Notifier{
+			{Webhook: &config.Webhook{URL: defaultURL}},
+			{Webhook: &config.Webhook{URL: successURL}, Events: []string{"backup_success"}},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, n.Notify(context.Background(), BackupSucceeded("home", nil)))
+	require.NoError(t, n.Notify(context.Background(), BackupFailed("home", errors.New("failed"))))
+	require.NoError(t, n.Notify(context.Background(), BackupStale("home", time.Now().Add(-72*time.Hour))))
+
+	require.Len(t, defaultRequests, 2)
+	require.Len(t, successRequests, 1)
+
+	// Notifying through nil Notifiers is no-op.
+	var nilNotifiers *Notifiers
+	require.NoError(t, nilNotifiers.Notify(context.Background(), BackupFailed("home", errors.New("failed"))))
+}
+
+func TestInvalidEvent(t *testing.T) {
+	_, err := FromConfig(&config.Notifications{
+		Notify: []*config.Notifier{
+			{Desktop: &config.Desktop{}, Events: []string{"backup_failed"}},
+		},
+	})
+	require.ErrorContains(t, err, "invalid event `backup_failed`")
+}
+
+func TestSMTPMessage(t *testing.T) {
+	s := NewSMTP("mail.example.com", 0, "", "", "kopyaship@example.com", []string{"a@example.com", "b@example.com"})
+	require.Equal(t, "mail.example.com:587", s.addr)
+
+	message := string(s.message(BackupFailed("home", errors.New("repository is locked"))))
+	header, body, ok := strings.Cut(message, "\r\n\r\n")
+	require.True(t, ok)
+	require.Contains(t, header, "To: a@example.com, b@example.com\r\n")
+	require.Contains(t, header, "Subject: [kopyaship] Backup home failed\r\n")
+	require.Contains(t, body, "repository is locked")
+}
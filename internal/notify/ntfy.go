@@ -0,0 +1,28 @@
+package notify
+
+import "context"
+
+// Ntfy publishes the notification to an ntfy topic.
+type Ntfy struct {
+	url      string
+	token    string
+	priority string
+}
+
+func NewNtfy(url, token, priority string) *Ntfy {
+	return &Ntfy{url: url, token: token, priority: priority}
+}
+
+func (nt *Ntfy) Notify(ctx context.Context, n *Notification) error {
+	headers := map[string]string{
+		"Title": n.Title,
+		"Tags":  string(n.Event),
+	}
+	if nt.priority != "" {
+		headers["Priority"] = nt.priority
+	}
+	if nt.token != "" {
+		headers["Authorization"] = "Bearer " + nt.token
+	}
+	return post(ctx, nt.url, []byte(n.Message), headers)
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP sends the notification by email.
+type SMTP struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewSMTP(host string, port int, username, password, from string, to []string) *SMTP {
+	if port == 0 {
+		port = 587
+	}
+	return &SMTP{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}
+}
+
+func (s *SMTP) Notify(ctx context.Context, n *Notification) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	// smtp.SendMail doesn't take a context. Don't wait for it after the context is done.
+	errChan := make(chan error, 1)
+	go func() { errChan <- smtp.SendMail(s.addr, auth, s.from, s.to, s.message(n)) }()
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %v", s.addr, ctx.Err())
+	}
+}
+
+func (s *SMTP) message(n *Notification) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "From: %s\r\n", s.from)
+	fmt.Fprintf(b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(b, "Subject: [kopyaship] %s\r\n", n.Title)
+	fmt.Fprintf(b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	fmt.Fprintf(b, "%s\r\n\r\nHost: %s\r\nTime: %s\r\n", n.Message, n.Hostname, n.Time.Format(time.DateTime))
+	return b.Bytes()
+}
@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Webhook sends the notification as JSON with a POST request.
+type Webhook struct {
+	url     string
+	headers map[string]string
+}
+
+func NewWebhook(url string, headers map[string]string) *Webhook {
+	return &Webhook{url: url, headers: headers}
+}
+
+func (w *Webhook) Notify(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	for key, value := range w.headers {
+		headers[key] = value
+	}
+	return post(ctx, w.url, body, headers)
+}
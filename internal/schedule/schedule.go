@@ -0,0 +1,24 @@
+// Package schedule parses the schedules of backups and replications.
+// It is kept apart from the scheduler, so that the config can validate
+// schedules without depending on it.
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Parse parses an interval (e.g. `6h`), or a cron expression
+// (e.g. `0 3 * * *` or `@daily`).
+func Parse(spec string) (cron.Schedule, error) {
+	d, err := time.ParseDuration(spec)
+	if err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("interval must be at least 1 second: %s", spec)
+		}
+		return cron.Every(d), nil
+	}
+	return cron.ParseStandard(spec)
+}
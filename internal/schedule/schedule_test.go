@@ -0,0 +1,29 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 3, 2, 10, 4, 5, 0, time.Local)
+
+	s, err := Parse("6h")
+	require.NoError(t, err)
+	require.Equal(t, now.Add(6*time.Hour), s.Next(now))
+
+	s, err = Parse("0 3 * * *")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 3, 3, 3, 0, 0, 0, time.Local), s.Next(now))
+
+	s, err = Parse("@daily")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 3, 3, 0, 0, 0, 0, time.Local), s.Next(now))
+
+	_, err = Parse("100ms")
+	require.Error(t, err)
+	_, err = Parse("every day")
+	require.Error(t, err)
+}
@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+
+	"github.com/tomruk/kopyaship/internal/schedule"
+	"github.com/tomruk/kopyaship/internal/state"
+)
+
+// How often the scheduler looks for due jobs.
+const defaultPollInterval = 30 * time.Second
+
+type (
+	// Scheduler runs jobs on their schedules.
+	//
+	// Instead of sleeping until the next run, the scheduler compares the wall
+	// clock against the next run time of every job periodically. Timers don't
+	// advance while the system is suspended, but the wall clock does, so runs
+	// that are missed during suspend are caught up shortly after resume.
+	// Start time of the last run is recorded in the state directory, so that
+	// runs missed while the service is not running are caught up too.
+	Scheduler struct {
+		log          *zap.Logger
+		state        *state.State
+		pollInterval time.Duration
+
+		mu   sync.Mutex
+		jobs []*job
+	}
+
+	job struct {
+		name     string
+		spec     string
+		schedule cron.Schedule
+		run      func() error
+		next     time.Time
+		running  bool
+	}
+
+	Entry struct {
+		Name      string    `json:"name"`
+		Schedule  string    `json:"schedule"`
+		Next      time.Time `json:"next"`
+		LastRun   time.Time `json:"last_run"`
+		LastError string    `json:"last_error,omitempty"`
+		Running   bool      `json:"running"`
+	}
+)
+
+func New(state *state.State, log *zap.Logger) *Scheduler {
+	return &Scheduler{
+		log:          log,
+		state:        state,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// Add adds a job that runs on the given schedule. Names of the jobs must be unique.
+//
+// If the job has run before, its next run is calculated from its last run.
+// If that is in the past, the job is due immediately.
+func (s *Scheduler) Add(name, spec string, run func() error) error {
+	schedule, err := schedule.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule of %s: %v", name, err)
+	}
+	st, err := s.state.Schedule(name)
+	if err != nil {
+		return err
+	}
+
+	j := &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		run:      run,
+	}
+	if st.LastRun.IsZero() {
+		j.next = schedule.Next(time.Now())
+	} else {
+		j.next = schedule.Next(st.LastRun)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.jobs {
+		if other.name == name {
+			return fmt.Errorf("job already exists: %s", name)
+		}
+	}
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+// Run runs the due jobs until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	s.runDue()
+	for {
+		select {
+		case <-ticker.C:
+			s.runDue()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) runDue() {
+	// Strip the monotonic clock reading, so that the wall clock is compared.
+	now := time.Now().Round(0)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if now.Before(j.next) {
+			continue
+		}
+		// Even if many runs are missed, the job runs only once.
+		j.next = j.schedule.Next(now)
+		if j.running {
+			s.log.Sugar().Warnf("Scheduled job `%s` is still running. Skipping this run. Next run: %s", j.name, j.next)
+			continue
+		}
+		j.running = true
+		go s.run(j, now)
+	}
+}
+
+func (s *Scheduler) run(j *job, start time.Time) {
+	s.log.Sugar().Infof("Running scheduled job: %s", j.name)
+	runErr := j.run()
+	if runErr != nil {
+		s.log.Sugar().Errorf("Scheduled job `%s` failed: %v", j.name, runErr)
+	} else {
+		s.log.Sugar().Infof("Scheduled job `%s` is successful", j.name)
+	}
+
+	err := s.state.UpdateSchedule(j.name, func(sc *state.Schedule) {
+		sc.LastRun = start
+		if runErr != nil {
+			sc.LastError = runErr.Error()
+		} else {
+			sc.LastError = ""
+		}
+	})
+	if err != nil {
+		s.log.Error(err.Error())
+	}
+
+	s.mu.Lock()
+	j.running = false
+	s.mu.Unlock()
+}
+
+// Entries returns the jobs sorted by their next run time.
+func (s *Scheduler) Entries() ([]*Entry, error) {
+	s.mu.Lock()
+	entries := make([]*Entry, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		entries = append(entries, &Entry{
+			Name:     j.name,
+			Schedule: j.spec,
+			Next:     j.next,
+			Running:  j.running,
+		})
+	}
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		st, err := s.state.Schedule(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		e.LastRun = st.LastRun
+		e.LastError = st.LastError
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Next.Before(entries[j].Next) })
+	return entries, nil
+}
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/tomruk/kopyaship/internal/state"
+)
+
+func TestCatchUp(t *testing.T) {
+	st := state.Open(t.TempDir())
+	// Last run was 2 days ago. A daily job is overdue.
+	err := st.UpdateSchedule("backup:home", func(sc *state.Schedule) {
+		sc.LastRun = time.Now().Add(-48 * time.Hour)
+	})
+	require.NoError(t, err)
+
+	s := New(st, zap.NewNop())
+	s.pollInterval = 10 * time.Millisecond
+	var runs atomic.Int32
+	require.NoError(t, s.Add("backup:home", "24h", func() error {
+		runs.Add(1)
+		return errors.New("repository is locked")
+	}))
+	// Never ran before. Not due until tomorrow.
+	require.NoError(t, s.Add("backup:documents", "24h", func() error {
+		t.Error("backup:documents shouldn't run")
+		return nil
+	}))
+	require.Error(t, s.Add("backup:home", "1h", func() error { return nil }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		sc, err := st.Schedule("backup:home")
+		return err == nil && sc.LastError != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	// Missed runs are caught up only once.
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(1), runs.Load())
+
+	entries, err := s.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "repository is locked", entries[0].LastError)
+	require.True(t, entries[0].Next.After(time.Now().Add(23*time.Hour)))
+}
+
+func TestSkipOverlappingRuns(t *testing.T) {
+	s := New(state.Open(t.TempDir()), zap.NewNop())
+	s.pollInterval = 10 * time.Millisecond
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	require.NoError(t, s.Add("backup:home", "1s", func() error {
+		runs.Add(1)
+		<-release
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// The first run blocks for more than one interval.
+	time.Sleep(2500 * time.Millisecond)
+	require.Equal(t, int32(1), runs.Load())
+	close(release)
+
+	require.Eventually(t, func() bool { return runs.Load() == 2 }, 3*time.Second, 10*time.Millisecond)
+}
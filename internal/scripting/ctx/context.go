@@ -1,5 +1,11 @@
 package ctx
 
+import (
+	"time"
+
+	"github.com/tomruk/kopyaship/internal/backup/provider"
+)
+
 type Context interface {
 	Backup() (c *BackupContext, ok bool)
 	IfileGeneration() (c *IfileGenerationContext, ok bool)
@@ -9,8 +15,12 @@ type (
 	BackupContext struct {
 		// Is it a "pre" hook?
 		Pre bool
-		// Is it a "post" hook?
+		// Is it a "post" hook? Post hooks run if the backup is successful.
 		Post bool
+		// Is it an "on_error" hook? These run if the backup has failed.
+		OnError bool
+		// Is it a "finally" hook? These run after the backup, whether it has failed or not.
+		Finally bool
 
 		Name string
 		// Target path of backup. (e.g. path of the restic repository.)
@@ -21,6 +31,22 @@ type (
 		Skip func()
 		// Are we going to generate an ifile and use it?
 		UseIfile bool
+		// Is it a dry run? (`kopyaship backup --dry-run --hooks`) Nothing is written to the repositories.
+		DryRun bool
+
+		// Fields below are only set for post, on_error and finally hooks.
+
+		// Error of the backup. nil if the backup is successful.
+		Err error
+		// ID of the created snapshot. If multiple snapshots are created, their IDs are separated by commas.
+		SnapshotID      string
+		Duration        time.Duration
+		FilesNew        uint64
+		FilesChanged    uint64
+		FilesUnmodified uint64
+		FilesProcessed  uint64
+		// Size of the data added to the repository, in bytes.
+		DataAdded uint64
 	}
 
 	IfileGenerationContext struct {
@@ -63,6 +89,49 @@ func NewBackupContext(
 	}
 }
 
+// Hook lists that run after a backup.
+const (
+	HookPost    = "post"
+	HookOnError = "on_error"
+	HookFinally = "finally"
+)
+
+// NewBackupResultContext returns the context of a hook that runs after a backup.
+// hook is one of HookPost, HookOnError and HookFinally. result can be nil if the backup has failed.
+func NewBackupResultContext(
+	hook string,
+	name string,
+	targetPath string,
+	base string,
+	paths []string,
+	useIfile bool,
+	result *provider.BackupResult,
+	err error,
+) Context {
+	c := &BackupContext{
+		Post:       hook == HookPost,
+		OnError:    hook == HookOnError,
+		Finally:    hook == HookFinally,
+		Name:       name,
+		TargetPath: targetPath,
+		Base:       base,
+		Paths:      paths,
+		Skip:       func() {}, // Noop for hooks that run after a backup
+		UseIfile:   useIfile,
+		Err:        err,
+	}
+	if result != nil {
+		c.SnapshotID = result.SnapshotID
+		c.Duration = result.Duration
+		c.FilesNew = result.FilesNew
+		c.FilesChanged = result.FilesChanged
+		c.FilesUnmodified = result.FilesUnmodified
+		c.FilesProcessed = result.FilesProcessed
+		c.DataAdded = result.DataAdded
+	}
+	return &context{backupContext: c}
+}
+
 func NewIfileGenerationContext(pre bool, ifile string, typ string) Context {
 	return &context{
 		ifileGenerationContext: &IfileGenerationContext{
@@ -0,0 +1,44 @@
+package state
+
+import "time"
+
+type (
+	Backup struct {
+		// Number of successful backups since the last check.
+		RunsSinceCheck int `json:"runs_since_check"`
+		// Result of the last check of all targets. It is successful only if all targets are verified.
+		Check
+		// Results of the last checks, by target name.
+		Targets map[string]*Check `json:"targets,omitempty"`
+	}
+
+	Check struct {
+		// Time of the last check, regardless of its result.
+		LastCheck time.Time `json:"last_check"`
+		// Error of the last check. Empty if the last check was successful.
+		LastCheckError string `json:"last_check_error,omitempty"`
+		// Time of the last successful check.
+		LastVerified time.Time `json:"last_verified"`
+	}
+)
+
+// Record records the result of a check done at t.
+func (c *Check) Record(t time.Time, err error) {
+	c.LastCheck = t
+	if err != nil {
+		c.LastCheckError = err.Error()
+	} else {
+		c.LastCheckError = ""
+		c.LastVerified = t
+	}
+}
+
+// Target returns the result of the last check of the target. If the target is not checked yet,
+// zero value is returned.
+func (b *Backup) Target(name string) *Check {
+	c, ok := b.Targets[name]
+	if !ok {
+		return &Check{}
+	}
+	return c
+}
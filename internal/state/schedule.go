@@ -0,0 +1,10 @@
+package state
+
+import "time"
+
+type Schedule struct {
+	// Start time of the last scheduled run.
+	LastRun time.Time `json:"last_run"`
+	// Error of the last scheduled run. Empty if it was successful.
+	LastError string `json:"last_error,omitempty"`
+}
@@ -0,0 +1,156 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+)
+
+const (
+	fileName     = "state.json"
+	lockFileName = "state.lock"
+)
+
+type (
+	// State is persisted in the state directory, and it is shared between
+	// the service and other kopyaship processes. Every update reloads the
+	// state from disk while holding a file lock.
+	State struct {
+		path string
+		lock *flock.Flock
+	}
+
+	content struct {
+		Backups   map[string]*Backup   `json:"backups"`
+		Schedules map[string]*Schedule `json:"schedules,omitempty"`
+	}
+)
+
+func Open(stateDir string) *State {
+	return &State{
+		path: filepath.Join(stateDir, fileName),
+		lock: flock.New(filepath.Join(stateDir, lockFileName)),
+	}
+}
+
+// Backup returns the state of the backup with the given name.
+// If no state is recorded yet, zero value is returned.
+func (s *State) Backup(name string) (*Backup, error) {
+	err := s.lock.RLock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.lock.Unlock()
+
+	c, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.Backups[name]
+	if !ok {
+		return &Backup{}, nil
+	}
+	return b, nil
+}
+
+// UpdateBackup calls f with the state of the backup with the given name,
+// and persists the changes f makes.
+func (s *State) UpdateBackup(name string, f func(b *Backup)) error {
+	err := s.lock.Lock()
+	if err != nil {
+		return err
+	}
+	defer s.lock.Unlock()
+
+	c, err := s.read()
+	if err != nil {
+		return err
+	}
+	b, ok := c.Backups[name]
+	if !ok {
+		b = &Backup{}
+		c.Backups[name] = b
+	}
+	f(b)
+	return s.write(c)
+}
+
+// Schedule returns the state of the scheduled job with the given name.
+// If no state is recorded yet, zero value is returned.
+func (s *State) Schedule(name string) (*Schedule, error) {
+	err := s.lock.RLock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.lock.Unlock()
+
+	c, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	sc, ok := c.Schedules[name]
+	if !ok {
+		return &Schedule{}, nil
+	}
+	return sc, nil
+}
+
+// UpdateSchedule calls f with the state of the scheduled job with the given name,
+// and persists the changes f makes.
+func (s *State) UpdateSchedule(name string, f func(sc *Schedule)) error {
+	err := s.lock.Lock()
+	if err != nil {
+		return err
+	}
+	defer s.lock.Unlock()
+
+	c, err := s.read()
+	if err != nil {
+		return err
+	}
+	sc, ok := c.Schedules[name]
+	if !ok {
+		sc = &Schedule{}
+		c.Schedules[name] = sc
+	}
+	f(sc)
+	return s.write(c)
+}
+
+func (s *State) read() (*content, error) {
+	c := &content{}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	} else if err == nil {
+		err = json.Unmarshal(data, c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.Backups == nil {
+		c.Backups = make(map[string]*Backup)
+	}
+	if c.Schedules == nil {
+		c.Schedules = make(map[string]*Schedule)
+	}
+	return c, nil
+}
+
+func (s *State) write(c *content) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so that the state
+	// is not lost if we're interrupted while writing.
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
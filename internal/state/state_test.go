@@ -0,0 +1,41 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateBackup(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(dir)
+
+	b, err := s.Backup("home")
+	require.NoError(t, err)
+	require.Zero(t, b.RunsSinceCheck)
+	require.True(t, b.LastCheck.IsZero())
+
+	now := time.Now().Round(0)
+	for i := 0; i < 3; i++ {
+		err = s.UpdateBackup("home", func(b *Backup) { b.RunsSinceCheck++ })
+		require.NoError(t, err)
+	}
+	err = s.UpdateBackup("documents", func(b *Backup) {
+		b.LastCheck = now
+		b.LastVerified = now
+	})
+	require.NoError(t, err)
+
+	// Ensure the state is read from disk.
+	s = Open(dir)
+	b, err = s.Backup("home")
+	require.NoError(t, err)
+	require.Equal(t, 3, b.RunsSinceCheck)
+
+	b, err = s.Backup("documents")
+	require.NoError(t, err)
+	require.True(t, now.Equal(b.LastCheck))
+	require.True(t, now.Equal(b.LastVerified))
+	require.Empty(t, b.LastCheckError)
+}
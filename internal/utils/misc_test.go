@@ -33,3 +33,10 @@ func TestStripDriveLetter(t *testing.T) {
 		require.Equal(t, expected[i], newPath)
 	}
 }
+
+func TestFormatBytes(t *testing.T) {
+	require.Equal(t, "0 B", FormatBytes(0))
+	require.Equal(t, "1023 B", FormatBytes(1023))
+	require.Equal(t, "1.5 KiB", FormatBytes(1536))
+	require.Equal(t, "2.0 GiB", FormatBytes(2<<30))
+}